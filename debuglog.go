@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	DefaultDebugHeader      = "X-Debug"
+	DefaultDebugMaxBodySize = 4096
+
+	redacted = "[REDACTED]"
+)
+
+// DefaultRedactHeaders are the headers redacted in debug captures, unless
+// DebugLogOptions.RedactHeaders is set.
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// DebugLogOptions configures capturing request and response headers and
+// bodies into the AccessEntry, to see what clients actually sent.
+type DebugLogOptions struct {
+	// Routes are the names of routes, e.g. "POST /v1/users", that are always
+	// captured.
+	Routes []string
+
+	// Header enables capturing a single request, if set to a non-empty value
+	// by a trusted client. Defaults to DefaultDebugHeader.
+	Header string
+
+	// TrustedClients are the networks in CIDR notation, e.g. "10.0.0.0/8",
+	// allowed to enable capturing using Header. If empty, Header is ignored.
+	TrustedClients []string
+
+	// MaxBodySize is the maximum number of bytes captured per body. Defaults
+	// to DefaultDebugMaxBodySize.
+	MaxBodySize int
+
+	// RedactHeaders are the names of headers whose values are replaced by
+	// "[REDACTED]". Defaults to DefaultRedactHeaders.
+	RedactHeaders []string
+
+	// RedactJSONFields are the names of fields in JSON bodies whose values are
+	// replaced by "[REDACTED]", e.g. "password". JSON bodies that cannot be
+	// parsed, e.g. because they were truncated, are replaced completely.
+	RedactJSONFields []string
+}
+
+// DebugCapture contains the headers and bodies captured for a request.
+type DebugCapture struct {
+	RequestHeader         http.Header `json:"request_header"`
+	RequestBody           string      `json:"request_body,omitempty"`
+	RequestBodyTruncated  bool        `json:"request_body_truncated,omitempty"`
+	ResponseHeader        http.Header `json:"response_header"`
+	ResponseBody          string      `json:"response_body,omitempty"`
+	ResponseBodyTruncated bool        `json:"response_body_truncated,omitempty"`
+}
+
+// SetDebugLogging enables capturing headers and bodies of the configured
+// requests. Access reporters log the captures, see `AccessEntry.Debug`.
+func (s *Server) SetDebugLogging(options DebugLogOptions) error {
+	debug, err := newDebugLogging(options)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	s.debugLogging = debug
+
+	return nil
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type debugLogging struct {
+	options        DebugLogOptions
+	routes         map[string]bool
+	trustedClients []*net.IPNet
+	redactHeaders  []string
+	redactFields   map[string]bool
+}
+
+func newDebugLogging(options DebugLogOptions) (*debugLogging, error) {
+	if options.Header == "" {
+		options.Header = DefaultDebugHeader
+	}
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = DefaultDebugMaxBodySize
+	}
+	if options.RedactHeaders == nil {
+		options.RedactHeaders = DefaultRedactHeaders
+	}
+
+	debug := &debugLogging{
+		options:       options,
+		routes:        map[string]bool{},
+		redactHeaders: options.RedactHeaders,
+		redactFields:  map[string]bool{},
+	}
+	for _, route := range options.Routes {
+		debug.routes[route] = true
+	}
+	for _, field := range options.RedactJSONFields {
+		debug.redactFields[strings.ToLower(field)] = true
+	}
+
+	nets, err := parseCIDRs(options.TrustedClients)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	debug.trustedClients = nets
+
+	return debug, nil
+}
+
+// enabledFor returns true if the request should be captured, either because
+// its route is configured, or a trusted client asked for it.
+func (d *debugLogging) enabledFor(req *http.Request, clientIP net.IP) bool {
+	if d.routes[currentRouteName(req)] {
+		return true
+	}
+
+	if req.Header.Get(d.options.Header) == "" {
+		return false
+	}
+
+	return containsIP(d.trustedClients, clientIP)
+}
+
+// start attaches a debugRecorder to the entry and captures the request body
+// as it is read by the middlewares.
+func (d *debugLogging) start(entry *AccessEntry, req *http.Request) {
+	recorder := &debugRecorder{
+		debug:         d,
+		requestHeader: req.Header.Clone(),
+		requestBody:   &cappedBuffer{max: d.options.MaxBodySize},
+		responseBody:  &cappedBuffer{max: d.options.MaxBodySize},
+	}
+	entry.debug = recorder
+
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &teeReadCloser{
+			Reader: io.TeeReader(req.Body, recorder.requestBody),
+			Closer: req.Body,
+		}
+	}
+}
+
+type debugRecorder struct {
+	debug          *debugLogging
+	requestHeader  http.Header
+	requestBody    *cappedBuffer
+	responseHeader http.Header
+	responseBody   *cappedBuffer
+	capture        *DebugCapture
+}
+
+// finish builds the capture, redacting sensitive values.
+func (r *debugRecorder) finish(w http.ResponseWriter) {
+	if r.responseHeader == nil {
+		r.responseHeader = w.Header().Clone()
+	}
+
+	r.capture = &DebugCapture{
+		RequestHeader:         r.redactHeader(r.requestHeader),
+		RequestBody:           r.redactBody(r.requestHeader, r.requestBody),
+		RequestBodyTruncated:  r.requestBody.truncated,
+		ResponseHeader:        r.redactHeader(r.responseHeader),
+		ResponseBody:          r.redactBody(r.responseHeader, r.responseBody),
+		ResponseBodyTruncated: r.responseBody.truncated,
+	}
+}
+
+func (r *debugRecorder) redactHeader(header http.Header) http.Header {
+	for _, name := range r.debug.redactHeaders {
+		if values, ok := header[http.CanonicalHeaderKey(name)]; ok {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+
+	return header
+}
+
+func (r *debugRecorder) redactBody(header http.Header, body *cappedBuffer) string {
+	if len(r.debug.redactFields) == 0 || body.buf.Len() == 0 || !strings.Contains(header.Get("Content-Type"), "json") {
+		return body.buf.String()
+	}
+
+	var value interface{}
+	if body.truncated || json.Unmarshal(body.buf.Bytes(), &value) != nil {
+		return redacted
+	}
+
+	raw, err := json.Marshal(redactJSON(value, r.debug.redactFields))
+	if err != nil {
+		return redacted
+	}
+
+	return string(raw)
+}
+
+func redactJSON(value interface{}, fields map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if fields[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = redactJSON(field, fields)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item, fields)
+		}
+	}
+
+	return value
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the rest.
+type cappedBuffer struct {
+	max       int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.max - b.buf.Len(); remaining < len(p) {
+		b.truncated = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"github.com/juju/errgo"
+)
+
+var (
+	ResponseWrittenError    = errgo.New("response already written")
+	LoggerNotFoundError     = errgo.New("logger not found")
+	LevelNotChangeableError = errgo.New("log level not changeable")
+)
+
+// IsResponseWritten returns true if the given error was caused by writing a
+// response that was already written.
+func IsResponseWritten(err error) bool {
+	return errgo.Cause(err) == ResponseWrittenError
+}
+
+// IsLoggerNotFound returns true if the given error was caused by changing the
+// level of a logger that is not registered.
+func IsLoggerNotFound(err error) bool {
+	return errgo.Cause(err) == LoggerNotFoundError
+}
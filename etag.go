@@ -0,0 +1,148 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// ETagMode defines whether and how ETags are computed for responses.
+type ETagMode int
+
+const (
+	// ETagNone disables the computation of ETags.
+	ETagNone ETagMode = iota
+
+	// ETagStrong computes strong ETags, e.g. `"5d41402abc4b2a76"`.
+	ETagStrong
+
+	// ETagWeak computes weak ETags, e.g. `W/"5d41402abc4b2a76"`.
+	ETagWeak
+)
+
+// NewETag formats the given opaque tag as ETag according to the given mode.
+// An empty string is returned for ETagNone.
+func NewETag(tag string, mode ETagMode) string {
+	switch mode {
+	case ETagStrong:
+		return `"` + tag + `"`
+	case ETagWeak:
+		return `W/"` + tag + `"`
+	default:
+		return ""
+	}
+}
+
+//------------------------------------------------------------------------------
+// private
+
+// bodyETag computes an ETag over the encoded body of a response.
+func bodyETag(body []byte, mode ETagMode) string {
+	sum := sha1.Sum(body)
+	return NewETag(hex.EncodeToString(sum[:]), mode)
+}
+
+// fileETag computes an ETag based on the size and modification time of a
+// file, like most static file servers do.
+func fileETag(size int64, modtime time.Time, mode ETagMode) string {
+	return NewETag(fmt.Sprintf("%x-%x", modtime.UnixNano(), size), mode)
+}
+
+// etagMatch reports whether one of the comma separated ETags in header
+// matches etag. Weak comparison ignores the `W/` prefix, as required for
+// `If-None-Match`. Strong comparison, as required for `If-Match`, never
+// matches weak ETags.
+func etagMatch(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+
+		if strings.HasPrefix(candidate, "W/") || strings.HasPrefix(etag, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified evaluates the `If-None-Match` and `If-Modified-Since` request
+// headers against the given ETag and `Last-Modified` header value. As
+// specified in RFC 7232, `If-Modified-Since` is ignored in case
+// `If-None-Match` is given.
+func notModified(req *http.Request, etag, lastModified string) bool {
+	if req == nil || (req.Method != "GET" && req.Method != "HEAD") {
+		return false
+	}
+
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag, true)
+	}
+
+	ims := req.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// newStaticHandler wraps a http.FileServer, so that it sends ETags when
+// enabled for the server. The file server itself answers conditional
+// requests based on the ETag header.
+func (s *Server) newStaticHandler(fsPath string) http.Handler {
+	root := http.Dir(fsPath)
+	fileServer := http.FileServer(root)
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if s.etagMode != ETagNone {
+			if etag := staticETag(root, req.URL.Path, s.etagMode); etag != "" {
+				res.Header().Set("ETag", etag)
+			}
+		}
+
+		fileServer.ServeHTTP(res, req)
+	})
+}
+
+func staticETag(root http.FileSystem, name string, mode ETagMode) string {
+	f, err := root.Open(path.Clean("/" + name))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return ""
+	}
+
+	return fileETag(info.Size(), info.ModTime(), mode)
+}
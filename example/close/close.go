@@ -19,6 +19,6 @@ func main() {
 		return ctx.Response.PlainText("OK", http.StatusOK)
 	})
 
-	srv.Logger.Info(nil, "This is the close example. Try `curl localhost:8080` to see what happens.")
+	srv.Logger.Info("This is the close example. Try `curl localhost:8080` to see what happens.")
 	srv.Listen()
 }
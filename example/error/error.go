@@ -14,6 +14,6 @@ func middlewareOne(res http.ResponseWriter, req *http.Request, ctx *server.Conte
 func main() {
 	srv := server.NewServer("127.0.0.1", "8080")
 	srv.Serve("GET", "/", middlewareOne)
-	srv.Logger.Info(nil, "This is the error example. Try `curl localhost:8080` to see what happens.")
+	srv.Logger.Info("This is the error example. Try `curl localhost:8080` to see what happens.")
 	srv.Listen()
 }
@@ -10,6 +10,6 @@ import (
 func main() {
 	srv := server.NewServer("127.0.0.1", "8080")
 	srv.ServeStatic("/", "./example/fileserver/public/")
-	srv.Logger.Info(nil, "This is the fileserver example. Try `curl localhost:8080` to see what happens.")
+	srv.Logger.Info("This is the fileserver example. Try `curl localhost:8080` to see what happens.")
 	srv.Listen()
 }
@@ -8,18 +8,18 @@ import (
 )
 
 type middleware struct {
-	logger requestcontext.Logger
+	logger server.Logger
 }
 
 func (m middleware) one(res http.ResponseWriter, req *http.Request, ctx *server.Context) error {
-	m.logger.Debug(nil, "I am hidden")
-	m.logger.Info(nil, "middleware one")
+	m.logger.Debug("I am hidden")
+	m.logger.Info("middleware one")
 
 	return ctx.Next()
 }
 
 func (m middleware) two(res http.ResponseWriter, req *http.Request, ctx *server.Context) error {
-	m.logger.Notice(ctx.Request, "middleware two")
+	ctx.Logger().Info("middleware two")
 
 	ctx.Request["foo"] = 12.38
 
@@ -27,14 +27,14 @@ func (m middleware) two(res http.ResponseWriter, req *http.Request, ctx *server.
 }
 
 func (m middleware) three(res http.ResponseWriter, req *http.Request, ctx *server.Context) error {
-	m.logger.Error(ctx.Request, "middleware three")
+	ctx.Logger().Error("middleware three", "foo", ctx.Request["foo"])
 
 	return ctx.Response.PlainText("OK", http.StatusOK)
 }
 
 func main() {
 	m := middleware{
-		logger: requestcontext.MustGetLogger(requestcontext.LoggerConfig{
+		logger: server.NewGoLoggingLogger(requestcontext.LoggerConfig{
 			Name:  "middleware-example",
 			Level: "info",
 			Color: true,
@@ -44,6 +44,6 @@ func main() {
 	srv := server.NewServer("127.0.0.1", "8080")
 	srv.SetLogger(m.logger)
 	srv.Serve("GET", "/", m.one, m.two, m.three)
-	srv.Logger.Info(nil, "This is the middleware example. Try `curl localhost:8080` to see what happens.")
+	srv.Logger.Info("This is the middleware example. Try `curl localhost:8080` to see what happens.")
 	srv.Listen()
 }
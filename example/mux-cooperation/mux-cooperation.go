@@ -33,7 +33,7 @@ func main() {
 	srv.RegisterRoutes(mux, "/v1")
 
 	// start http server with merged mux
-	srv.Logger.Info(nil, "This is the mix-cooperation example. Try `curl localhost:8080`, or `curl localhost:8080/v1/middleware` to see what happens.")
+	srv.Logger.Info("This is the mix-cooperation example. Try `curl localhost:8080`, or `curl localhost:8080/v1/middleware` to see what happens.")
 	if err := http.ListenAndServe("127.0.0.1:8080", mux); err != nil {
 		panic(err)
 	}
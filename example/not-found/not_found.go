@@ -18,6 +18,6 @@ func main() {
 	srv := server.NewServer("127.0.0.1", "8080")
 	srv.Serve("GET", "/", middlewareOne)
 	srv.ServeNotFound(notFound)
-	srv.Logger.Info(nil, "This is the not-found example. Try `curl localhost:8080`, or `curl localhost:8080/foo` to see what happens.")
+	srv.Logger.Info("This is the not-found example. Try `curl localhost:8080`, or `curl localhost:8080/foo` to see what happens.")
 	srv.Listen()
 }
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"time"
+
 	"github.com/juju/errgo"
 )
 
 const (
 	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"
 	StatusUnhealthy = "unhealthy"
 )
 
@@ -14,11 +17,34 @@ type HealthInfo struct {
 	App      string       `json:"app"`
 	Version  string       `json:"version"`
 	Backends []HealthInfo `json:"backends"`
+
+	// Name identifies a backend checked by a HealthRegistry.
+	Name string `json:"name,omitempty"`
+
+	// Error is the reason a backend is unhealthy.
+	Error string `json:"error,omitempty"`
+
+	// Duration is the time in milliseconds it took to check a backend.
+	Duration float64 `json:"duration_ms,omitempty"`
+
+	// NonCritical marks a backend the service can work without, e.g. a
+	// cache. If it fails, the service is degraded instead of unhealthy.
+	NonCritical bool `json:"non_critical,omitempty"`
+
+	// LastChange is the time the status last changed, as tracked by a
+	// HealthRegistry.
+	LastChange *time.Time `json:"last_change,omitempty"`
+
+	// ConsecutiveFailures is the number of checks in a row that reported the
+	// backend unhealthy, as tracked by a HealthRegistry.
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty"`
 }
 
 type Healthchecker func() (HealthInfo, error)
 
-// Status just accumulates the backends status to calculate the main status.
+// Status accumulates the backends status to calculate the main status. The
+// service is unhealthy if itself or a critical backend is unhealthy, and
+// degraded if a non-critical backend is unhealthy or any backend is degraded.
 func (hc Healthchecker) Status() (HealthInfo, error) {
 	info, err := hc()
 	if err != nil {
@@ -34,19 +60,32 @@ func IsStatusHealthy(status string) bool {
 	return status == StatusHealthy
 }
 
+// IsStatusAvailable returns true if the service can serve requests, that is
+// it is healthy or degraded.
+func IsStatusAvailable(status string) bool {
+	return status == StatusHealthy || status == StatusDegraded
+}
+
 //------------------------------------------------------------------------------
 // private
 
 func checkStatus(info HealthInfo) string {
-	if !IsStatusHealthy(info.Status) {
+	if !IsStatusAvailable(info.Status) {
 		return StatusUnhealthy
 	}
 
+	status := info.Status
 	for _, res := range info.Backends {
-		if !IsStatusHealthy(checkStatus(res)) {
-			return StatusUnhealthy
+		switch checkStatus(res) {
+		case StatusUnhealthy:
+			if !res.NonCritical {
+				return StatusUnhealthy
+			}
+			status = StatusDegraded
+		case StatusDegraded:
+			status = StatusDegraded
 		}
 	}
 
-	return StatusHealthy
+	return status
 }
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	// maxHealthCheckBody is the maximum number of bytes read from responses
+	// checked by HTTPHealthCheck.
+	maxHealthCheckBody = 1 << 20
+)
+
+// HTTPCheckOptions configures HTTPHealthCheck.
+type HTTPCheckOptions struct {
+	// Status is the expected status code. Defaults to any 2xx code.
+	Status int
+
+	// BodyContains is a string the response body must contain, if set.
+	BodyContains string
+
+	// Header is added to the request, e.g. for authentication.
+	Header http.Header
+
+	// Client sends the request. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// HTTPHealthCheck creates a check sending a GET request to url.
+func HTTPHealthCheck(url string, options HTTPCheckOptions) HealthCheck {
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		req = req.WithContext(ctx)
+		for name, values := range options.Header {
+			req.Header[name] = values
+		}
+
+		res, err := options.Client.Do(req)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		defer func() {
+			// Drain the body, so the connection is reused by the next check.
+			io.Copy(io.Discard, io.LimitReader(res.Body, maxHealthCheckBody))
+			res.Body.Close()
+		}()
+
+		if options.Status != 0 && res.StatusCode != options.Status {
+			return errgo.Newf("expected status %d, got %d", options.Status, res.StatusCode)
+		}
+		if options.Status == 0 && res.StatusCode/100 != 2 {
+			return errgo.Newf("expected status 2xx, got %d", res.StatusCode)
+		}
+
+		if options.BodyContains != "" {
+			body, err := io.ReadAll(io.LimitReader(res.Body, maxHealthCheckBody))
+			if err != nil {
+				return errgo.Mask(err)
+			}
+			if !strings.Contains(string(body), options.BodyContains) {
+				return errgo.Newf("expected body to contain '%s'", options.BodyContains)
+			}
+		}
+
+		return nil
+	}
+}
+
+// TCPHealthCheck creates a check opening a TCP connection to addr, e.g.
+// "localhost:6379".
+func TCPHealthCheck(addr string) HealthCheck {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+
+		return conn.Close()
+	}
+}
+
+// DNSHealthCheck creates a check resolving host.
+func DNSHealthCheck(host string) HealthCheck {
+	return func(ctx context.Context) error {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		if len(addrs) == 0 {
+			return errgo.Newf("no addresses found for '%s'", host)
+		}
+
+		return nil
+	}
+}
+
+// DiskFreeHealthCheck creates a check failing if less than minFree bytes are
+// available to unprivileged users on the filesystem containing path. It is
+// supported on Linux and macOS.
+func DiskFreeHealthCheck(path string, minFree uint64) HealthCheck {
+	return func(ctx context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		if free < minFree {
+			return errgo.Newf("%d bytes free on '%s', expected at least %d", free, path, minFree)
+		}
+
+		return nil
+	}
+}
+
+// SQLHealthCheck creates a check pinging the database.
+func SQLHealthCheck(db *sql.DB) HealthCheck {
+	return func(ctx context.Context) error {
+		if err := db.PingContext(ctx); err != nil {
+			return errgo.Mask(err)
+		}
+
+		return nil
+	}
+}
+
+// FileHealthCheck creates a check failing if path does not exist, e.g. a
+// mounted secret or a maintenance flag.
+func FileHealthCheck(path string) HealthCheck {
+	return func(ctx context.Context) error {
+		if _, err := os.Stat(path); err != nil {
+			return errgo.Mask(err)
+		}
+
+		return nil
+	}
+}
+
+// GoroutinesHealthCheck creates a check failing if more than max goroutines
+// exist, which usually indicates a leak.
+func GoroutinesHealthCheck(max int) HealthCheck {
+	return func(ctx context.Context) error {
+		if n := runtime.NumGoroutine(); n > max {
+			return errgo.Newf("%d goroutines, expected at most %d", n, max)
+		}
+
+		return nil
+	}
+}
+
+// HeapHealthCheck creates a check failing if more than maxBytes are allocated
+// on the heap.
+func HeapHealthCheck(maxBytes uint64) HealthCheck {
+	return func(ctx context.Context) error {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		if mem.HeapAlloc > maxBytes {
+			return errgo.Newf("%d heap bytes allocated, expected at most %d", mem.HeapAlloc, maxBytes)
+		}
+
+		return nil
+	}
+}
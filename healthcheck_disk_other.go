@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package server
+
+import (
+	"github.com/juju/errgo"
+)
+
+// diskFree is not supported on this platform.
+func diskFree(path string) (uint64, error) {
+	return 0, errgo.New("disk free check not supported on this platform")
+}
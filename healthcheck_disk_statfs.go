@@ -0,0 +1,21 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package server
+
+import (
+	"syscall"
+
+	"github.com/juju/errgo"
+)
+
+// diskFree returns the bytes available to unprivileged users on the
+// filesystem containing path.
+func diskFree(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, errgo.Mask(err)
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	HealthJSONContentType = "application/health+json"
+
+	// Formats selectable using the format query parameter, e.g.
+	// `/healthcheck?format=prometheus`.
+	HealthFormatJSON       = "json"
+	HealthFormatHealthJSON = "health"
+	HealthFormatPrometheus = "prometheus"
+)
+
+// HealthJSON is a health report in the IETF health check response format,
+// see https://tools.ietf.org/html/draft-inadarei-api-health-check.
+type HealthJSON struct {
+	Status    string                       `json:"status"`
+	ReleaseID string                       `json:"releaseId,omitempty"`
+	ServiceID string                       `json:"serviceId,omitempty"`
+	Output    string                       `json:"output,omitempty"`
+	Checks    map[string][]HealthJSONCheck `json:"checks,omitempty"`
+}
+
+// HealthJSONCheck is the result of a single backend in a HealthJSON report.
+type HealthJSONCheck struct {
+	ComponentID   string     `json:"componentId"`
+	Status        string     `json:"status"`
+	ObservedValue *float64   `json:"observedValue,omitempty"`
+	ObservedUnit  string     `json:"observedUnit,omitempty"`
+	Time          *time.Time `json:"time,omitempty"`
+	Output        string     `json:"output,omitempty"`
+}
+
+// NewHealthJSON converts info into the IETF health check response format.
+// Healthy maps to "pass", degraded to "warn" and unhealthy to "fail". Nested
+// backends are flattened using their path, e.g. "search/elasticsearch", and
+// report the check duration in milliseconds as observed value.
+func NewHealthJSON(info HealthInfo) HealthJSON {
+	report := HealthJSON{
+		Status:    healthJSONStatus(info.Status),
+		ReleaseID: info.Version,
+		ServiceID: info.App,
+		Output:    info.Error,
+		Checks:    map[string][]HealthJSONCheck{},
+	}
+
+	for _, backend := range flattenBackends(info.Backends, "") {
+		check := HealthJSONCheck{
+			ComponentID: backend.path,
+			Status:      healthJSONStatus(checkStatus(backend.info)),
+			Time:        backend.info.LastChange,
+			Output:      backend.info.Error,
+		}
+		if backend.info.Duration > 0 {
+			duration := backend.info.Duration
+			check.ObservedValue = &duration
+			check.ObservedUnit = "ms"
+		}
+
+		key := backend.path + ":responseTime"
+		report.Checks[key] = append(report.Checks[key], check)
+	}
+
+	return report
+}
+
+// WriteHealthPrometheus writes info as Prometheus gauges. The status of the
+// service and of every backend is reported as one series per status, set to
+// 1 for the current status and 0 otherwise, e.g.
+// `health_backend_status{app="myapp",backend="database",status="healthy"} 1`.
+func WriteHealthPrometheus(w io.Writer, info HealthInfo) error {
+	cw := &countingWriter{w: w}
+	app := "app=" + quoteLabel(info.App)
+
+	writeGaugeHeader(cw, "health_status", "Status of the service.")
+	writeHealthStatus(cw, "health_status", app+",version="+quoteLabel(info.Version), checkStatus(info))
+
+	backends := flattenBackends(info.Backends, "")
+	if len(backends) == 0 {
+		return cw.err
+	}
+
+	writeGaugeHeader(cw, "health_backend_status", "Status of the backends of the service.")
+	for _, backend := range backends {
+		writeHealthStatus(cw, "health_backend_status", app+",backend="+quoteLabel(backend.path), checkStatus(backend.info))
+	}
+
+	writeGaugeHeader(cw, "health_backend_duration_seconds", "Duration of the last check of the backends.")
+	for _, backend := range backends {
+		cw.printf("health_backend_duration_seconds{%s,backend=%s} %s\n", app, quoteLabel(backend.path), formatFloat(backend.info.Duration/1000))
+	}
+
+	writeGaugeHeader(cw, "health_backend_consecutive_failures", "Number of checks in a row the backends were unhealthy.")
+	for _, backend := range backends {
+		cw.printf("health_backend_consecutive_failures{%s,backend=%s} %d\n", app, quoteLabel(backend.path), backend.info.ConsecutiveFailures)
+	}
+
+	return cw.err
+}
+
+//------------------------------------------------------------------------------
+// private
+
+var healthStatuses = []string{StatusHealthy, StatusDegraded, StatusUnhealthy}
+
+type flatBackend struct {
+	path string
+	info HealthInfo
+}
+
+// writeHealth responds info in the format requested by the format query
+// parameter or the Accept header, defaulting to HealthInfo as JSON.
+func writeHealth(req *http.Request, ctx *Context, info HealthInfo, code int) error {
+	ctx.Response.w.Header().Add("Vary", "Accept")
+
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = negotiateHealthFormat(req.Header.Get("Accept"))
+	}
+
+	var body bytes.Buffer
+	var contentType string
+	switch format {
+	case HealthFormatJSON:
+		return ctx.Response.Json(info, code)
+	case HealthFormatHealthJSON:
+		if err := json.NewEncoder(&body).Encode(NewHealthJSON(info)); err != nil {
+			return errgo.Mask(err)
+		}
+		contentType = HealthJSONContentType
+	case HealthFormatPrometheus:
+		if err := WriteHealthPrometheus(&body, info); err != nil {
+			return errgo.Mask(err)
+		}
+		contentType = MetricsContentType
+	default:
+		return ctx.Response.Error("unknown format "+strconv.Quote(format)+"\n", http.StatusBadRequest)
+	}
+
+	if ctx.Response.Written() {
+		return errgo.Mask(ResponseWrittenError, errgo.Any)
+	}
+
+	ctx.Response.w.Header().Set("Content-Type", contentType)
+	return ctx.Response.writeConditional(body.Bytes(), code)
+}
+
+// negotiateHealthFormat picks the format of the media type with the highest
+// quality in accept. Wildcards and unsupported media types select JSON.
+func negotiateHealthFormat(accept string) string {
+	formats := map[string]string{
+		"application/json":             HealthFormatJSON,
+		HealthJSONContentType:          HealthFormatHealthJSON,
+		"text/plain":                   HealthFormatPrometheus,
+		"application/openmetrics-text": HealthFormatPrometheus,
+	}
+
+	best, bestQuality := HealthFormatJSON, 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		format, ok := formats[strings.ToLower(strings.TrimSpace(params[0]))]
+		if !ok {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+
+	return best
+}
+
+func healthJSONStatus(status string) string {
+	switch status {
+	case StatusHealthy:
+		return "pass"
+	case StatusDegraded:
+		return "warn"
+	default:
+		return "fail"
+	}
+}
+
+// flattenBackends returns all backends depth first, named by their path.
+// Backends without name, e.g. of a hand-written Healthchecker, are named by
+// their app.
+func flattenBackends(backends []HealthInfo, prefix string) []flatBackend {
+	var flat []flatBackend
+	for _, backend := range backends {
+		name := backend.Name
+		if name == "" {
+			name = backend.App
+		}
+		path := prefix + name
+
+		flat = append(flat, flatBackend{path: path, info: backend})
+		flat = append(flat, flattenBackends(backend.Backends, path+"/")...)
+	}
+
+	return flat
+}
+
+func writeGaugeHeader(w *countingWriter, name, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+func writeHealthStatus(w *countingWriter, name, labels, status string) {
+	for _, s := range healthStatuses {
+		value := 0
+		if s == status {
+			value = 1
+		}
+		w.printf("%s{%s,status=%s} %d\n", name, labels, quoteLabel(s), value)
+	}
+}
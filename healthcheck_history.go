@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	DefaultHealthWebhookTimeout = 10 * time.Second
+)
+
+// HealthTransition describes a change of the status of a backend, or of the
+// service itself, in which case Backend is the app name.
+type HealthTransition struct {
+	Backend string    `json:"backend"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Time    time.Time `json:"time"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// SetHistorySize sets the number of transitions kept per backend. Defaults to
+// DefaultHealthHistorySize. Zero, or a negative size, keeps no history.
+func (r *HealthRegistry) SetHistorySize(size int) {
+	if size < 0 {
+		size = 0
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.historySize = size
+	for backend, history := range r.history {
+		if len(history) > size {
+			r.history[backend] = history[len(history)-size:]
+		}
+		if size == 0 {
+			delete(r.history, backend)
+		}
+	}
+}
+
+// SetLogger enables logging every transition, as warning if a backend
+// becomes unhealthy. Logging is disabled by default, e.g. pass
+// `srv.Logger` to log using the logger of the server.
+func (r *HealthRegistry) SetLogger(logger Logger) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.logger = logger
+}
+
+// OnChange registers a callback invoked for every transition, after the run
+// detecting it finished. Callbacks should not block.
+func (r *HealthRegistry) OnChange(callback func(t HealthTransition)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.callbacks = append(r.callbacks, callback)
+}
+
+// AddWebhook posts every transition as JSON object to url in the background.
+// Failures are logged, see SetLogger.
+func (r *HealthRegistry) AddWebhook(url string) {
+	client := &http.Client{Timeout: DefaultHealthWebhookTimeout}
+
+	r.OnChange(func(t HealthTransition) {
+		go func() {
+			if err := postHealthTransition(client, url, t); err != nil {
+				r.mutex.Lock()
+				logger := r.logger
+				r.mutex.Unlock()
+
+				if logger != nil {
+					logger.Error("posting health transition failed", "url", url, "error", err)
+				}
+			}
+		}()
+	})
+}
+
+// History returns the recent transitions per backend, oldest first.
+func (r *HealthRegistry) History() map[string][]HealthTransition {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	history := map[string][]HealthTransition{}
+	for backend, transitions := range r.history {
+		history[backend] = append([]HealthTransition{}, transitions...)
+	}
+
+	return history
+}
+
+// NewHealthHistoryMiddleware provides a middleware that responds the recent
+// transitions of all backends as JSON. E.g. one can register this under
+// /healthcheck/history.
+func NewHealthHistoryMiddleware(r *HealthRegistry) Middleware {
+	return func(res http.ResponseWriter, req *http.Request, ctx *Context) error {
+		return ctx.Response.Json(r.History(), http.StatusOK)
+	}
+}
+
+//------------------------------------------------------------------------------
+// private
+
+func postHealthTransition(client *http.Client, url string, t HealthTransition) error {
+	body, err := json.Marshal(t)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	res, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return errgo.Newf("webhook responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+// Initializer prepares the service, e.g. by warming up caches. See
+// `Server.AddInitializer`.
+type Initializer func(ctx context.Context) error
+
+// NewLivenessMiddleware provides a middleware answering liveness probes, e.g.
+// of Kubernetes. It responds 503 if the given Healthchecker, which may be
+// nil, is unhealthy. Liveness should only fail if restarting the process
+// helps, so usually no backends are checked. Add the `verbose` query
+// parameter to get the JSON tree.
+func NewLivenessMiddleware(hc Healthchecker) Middleware {
+	return func(res http.ResponseWriter, req *http.Request, ctx *Context) error {
+		return writeProbe(req, ctx, probeStatus(hc))
+	}
+}
+
+// NewReadinessMiddleware provides a middleware answering readiness probes. It
+// responds 503 while the given server is starting up or shutting down, see
+// `Server.Closing`, or if the given Healthchecker, which may be nil, is
+// unhealthy. Add the `verbose` query parameter to get the JSON tree.
+func NewReadinessMiddleware(s *Server, hc Healthchecker) Middleware {
+	return func(res http.ResponseWriter, req *http.Request, ctx *Context) error {
+		info := probeStatus(hc)
+		if !s.started() {
+			info.Status = StatusUnhealthy
+			info.Error = "server is starting up"
+		}
+		if s.Closing() {
+			info.Status = StatusUnhealthy
+			info.Error = "server is shutting down"
+		}
+
+		return writeProbe(req, ctx, info)
+	}
+}
+
+// NewStartupMiddleware provides a middleware answering startup probes. It
+// responds 503 until all initializers of the given server finished
+// successfully, see `Server.AddInitializer`. Add the `verbose` query parameter
+// to get the JSON tree with one entry per initializer.
+func NewStartupMiddleware(s *Server) Middleware {
+	return func(res http.ResponseWriter, req *http.Request, ctx *Context) error {
+		return writeProbe(req, ctx, s.startupStatus())
+	}
+}
+
+// AddInitializer registers an initializer run by Listen. The startup probe
+// and the readiness probe fail until all initializers finished successfully.
+func (s *Server) AddInitializer(name string, init Initializer) {
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
+	s.initializers = append(s.initializers, &initializerState{name: name, init: init})
+}
+
+// RunInitializers runs all initializers in the order they were added and
+// returns the error of the first failing one. Listen calls it in the
+// background.
+func (s *Server) RunInitializers(ctx context.Context) error {
+	s.initMutex.Lock()
+	initializers := append([]*initializerState{}, s.initializers...)
+	s.initMutex.Unlock()
+
+	for _, state := range initializers {
+		start := time.Now()
+		err := state.init(ctx)
+
+		s.initMutex.Lock()
+		state.done = err == nil
+		state.err = err
+		state.duration = time.Since(start)
+		s.initMutex.Unlock()
+
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type initializerState struct {
+	name     string
+	init     Initializer
+	done     bool
+	err      error
+	duration time.Duration
+}
+
+// started returns true if all initializers finished successfully.
+func (s *Server) started() bool {
+	return IsStatusHealthy(s.startupStatus().Status)
+}
+
+func (s *Server) startupStatus() HealthInfo {
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
+	info := HealthInfo{
+		Status:   StatusHealthy,
+		Backends: []HealthInfo{},
+	}
+	for _, state := range s.initializers {
+		backend := HealthInfo{
+			Name:     state.name,
+			Status:   StatusHealthy,
+			Backends: []HealthInfo{},
+			Duration: float64(state.duration) / float64(time.Millisecond),
+		}
+		if !state.done {
+			backend.Status = StatusUnhealthy
+			backend.Error = "pending"
+		}
+		if state.err != nil {
+			backend.Error = state.err.Error()
+		}
+		info.Backends = append(info.Backends, backend)
+	}
+	info.Status = checkStatus(info)
+
+	return info
+}
+
+// runInitializers runs the initializers and logs the outcome.
+func (s *Server) runInitializers() {
+	s.initMutex.Lock()
+	count := len(s.initializers)
+	s.initMutex.Unlock()
+	if count == 0 {
+		return
+	}
+
+	if err := s.RunInitializers(context.Background()); err != nil {
+		s.Logger.Error("initialization failed", "error", err)
+		return
+	}
+	s.Logger.Info("initialization finished", "initializers", count)
+}
+
+// probeStatus returns the health reported by hc. Errors make the service
+// unhealthy.
+func probeStatus(hc Healthchecker) HealthInfo {
+	if hc == nil {
+		return HealthInfo{Status: StatusHealthy, Backends: []HealthInfo{}}
+	}
+
+	info, err := hc.Status()
+	if err != nil {
+		return HealthInfo{Status: StatusUnhealthy, Backends: []HealthInfo{}, Error: err.Error()}
+	}
+
+	return info
+}
+
+// writeProbe responds 200 for healthy and degraded services and 503
+// otherwise, the status as plain text or, if the `verbose` query parameter is
+// given, the JSON tree.
+func writeProbe(req *http.Request, ctx *Context, info HealthInfo) error {
+	code := http.StatusOK
+	if !IsStatusAvailable(info.Status) {
+		code = http.StatusServiceUnavailable
+	}
+
+	if _, ok := req.URL.Query()["verbose"]; ok {
+		return writeHealth(req, ctx, info, code)
+	}
+
+	return ctx.Response.PlainText(info.Status+"\n", code)
+}
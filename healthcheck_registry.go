@@ -0,0 +1,374 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	DefaultHealthCheckTimeout = 5 * time.Second
+	DefaultHealthHistorySize  = 20
+)
+
+// HealthCheck checks a single backend, e.g. by pinging a database, and
+// returns an error if the backend is unhealthy. It should return once ctx is
+// done.
+type HealthCheck func(ctx context.Context) error
+
+// HealthCheckOptions configures a check registered at a HealthRegistry.
+type HealthCheckOptions struct {
+	// Timeout is the maximum duration of the check, after which the backend
+	// is considered unhealthy. Defaults to DefaultHealthCheckTimeout.
+	Timeout time.Duration
+
+	// NonCritical marks a backend the service can work without, see
+	// `HealthInfo.NonCritical`.
+	NonCritical bool
+}
+
+// HealthRegistry runs the checks of all registered backends in parallel, so
+// a single hanging backend cannot stall the healthcheck. Use `Check` as
+// Healthchecker, e.g. `NewHealthcheckMiddleware(registry.Check)`.
+type HealthRegistry struct {
+	app     string
+	version string
+
+	mutex    sync.Mutex
+	checks   []registeredHealthCheck
+	running  *healthRun
+	ttl      time.Duration
+	cached   *HealthInfo
+	cachedAt time.Time
+	states   map[string]*healthState
+	stop     chan struct{}
+
+	historySize int
+	history     map[string][]HealthTransition
+	callbacks   []func(HealthTransition)
+	logger      Logger
+}
+
+// NewHealthRegistry creates a new HealthRegistry reporting the given app name
+// and version.
+func NewHealthRegistry(app, version string) *HealthRegistry {
+	return &HealthRegistry{
+		app:     app,
+		version: version,
+		states:  map[string]*healthState{},
+
+		historySize: DefaultHealthHistorySize,
+		history:     map[string][]HealthTransition{},
+	}
+}
+
+// SetCacheTTL makes Check return the result of the last run until it is
+// older than ttl, so frequent probes don't hit the backends every time.
+func (r *HealthRegistry) SetCacheTTL(ttl time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ttl = ttl
+}
+
+// StartRefresh runs the checks every interval in the background. Combined
+// with a cache TTL larger than interval, probes are always served from the
+// cache. Call Close to stop refreshing.
+func (r *HealthRegistry) StartRefresh(interval time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	r.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			r.CheckFresh()
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops refreshing in the background.
+func (r *HealthRegistry) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// Register adds the check of the named backend. Backends are reported in the
+// order they were registered. The name must not be empty or the name of the
+// app, which identifies the service itself, see HealthTransition.
+func (r *HealthRegistry) Register(name string, check HealthCheck, options HealthCheckOptions) {
+	if name == "" || name == r.app {
+		panic(fmt.Sprintf("invalid backend name '%s'", name))
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultHealthCheckTimeout
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.checks = append(r.checks, registeredHealthCheck{
+		name:    name,
+		check:   check,
+		options: options,
+	})
+}
+
+// Check returns the health of the service with one entry per backend. The
+// checks run in parallel, unless a cached result is available, see
+// SetCacheTTL. Concurrent calls share the result of a run in progress.
+func (r *HealthRegistry) Check() (HealthInfo, error) {
+	return r.join(true), nil
+}
+
+// CheckFresh runs all checks, ignoring the cache, and updates the cache. Use
+// it to force a fresh run, e.g.
+// `NewHealthcheckMiddleware(registry.CheckFresh)` under a separate route. A
+// run in progress is shared like for Check.
+func (r *HealthRegistry) CheckFresh() (HealthInfo, error) {
+	return r.join(false), nil
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type registeredHealthCheck struct {
+	name    string
+	check   HealthCheck
+	options HealthCheckOptions
+}
+
+// healthRun is a run of all checks in progress, which concurrent callers
+// wait for instead of starting their own.
+type healthRun struct {
+	done chan struct{}
+	info HealthInfo
+}
+
+// healthState tracks the status of a backend across runs.
+type healthState struct {
+	status     string
+	lastChange time.Time
+	failures   int
+}
+
+// cachedInfo returns the cached result, unless it expired. The caller must
+// hold mutex.
+func (r *HealthRegistry) cachedInfo() (HealthInfo, bool) {
+	if r.cached == nil || r.ttl <= 0 || time.Since(r.cachedAt) >= r.ttl {
+		return HealthInfo{}, false
+	}
+
+	info := *r.cached
+	info.Backends = append([]HealthInfo{}, r.cached.Backends...)
+
+	return info, true
+}
+
+// join returns the result of the run in progress, or starts a new run if
+// there is none. If useCache is set, a cached result is returned instead, if
+// available. Only one run is in progress at a time, so status changes are
+// tracked in order.
+func (r *HealthRegistry) join(useCache bool) HealthInfo {
+	r.mutex.Lock()
+	if useCache {
+		if info, ok := r.cachedInfo(); ok {
+			r.mutex.Unlock()
+			return info
+		}
+	}
+	run := r.running
+	if run != nil {
+		r.mutex.Unlock()
+		<-run.done
+
+		info := run.info
+		info.Backends = append([]HealthInfo{}, run.info.Backends...)
+
+		return info
+	}
+	run = &healthRun{done: make(chan struct{})}
+	r.running = run
+	r.mutex.Unlock()
+
+	info := r.run()
+	run.info = info
+	run.info.Backends = append([]HealthInfo{}, info.Backends...)
+
+	r.mutex.Lock()
+	r.running = nil
+	r.mutex.Unlock()
+	close(run.done)
+
+	return info
+}
+
+// run runs all checks, tracks the status changes and caches the result. Use
+// join to not run concurrently.
+func (r *HealthRegistry) run() HealthInfo {
+	r.mutex.Lock()
+	checks := append([]registeredHealthCheck{}, r.checks...)
+	r.mutex.Unlock()
+
+	info := HealthInfo{
+		Status:   StatusHealthy,
+		App:      r.app,
+		Version:  r.version,
+		Backends: make([]HealthInfo, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check registeredHealthCheck) {
+			defer wg.Done()
+			info.Backends[i] = check.run()
+		}(i, check)
+	}
+	wg.Wait()
+
+	info.Status = checkStatus(info)
+
+	now := time.Now()
+
+	r.mutex.Lock()
+	var transitions []HealthTransition
+	for i := range info.Backends {
+		transitions = r.track(transitions, &info.Backends[i], info.Backends[i].Name, now)
+	}
+	// The service itself is tracked using the empty name.
+	transitions = r.track(transitions, &info, "", now)
+
+	cached := info
+	cached.Backends = append([]HealthInfo{}, info.Backends...)
+	r.cached = &cached
+	r.cachedAt = now
+
+	logger := r.logger
+	callbacks := append([]func(HealthTransition){}, r.callbacks...)
+	r.mutex.Unlock()
+
+	for _, t := range transitions {
+		if logger != nil {
+			log := logger.Info
+			if t.To == StatusUnhealthy {
+				log = logger.Warn
+			}
+			log("health status changed", "backend", t.Backend, "from", t.From, "to", t.To, "error", t.Error)
+		}
+		for _, callback := range callbacks {
+			callback(t)
+		}
+	}
+
+	return info
+}
+
+// track updates the state of the named backend with the given result,
+// records the state in it and appends a transition if the status changed.
+// The caller must hold mutex.
+func (r *HealthRegistry) track(transitions []HealthTransition, info *HealthInfo, name string, now time.Time) []HealthTransition {
+	state, ok := r.states[name]
+	if !ok {
+		state = &healthState{status: info.Status, lastChange: now}
+		r.states[name] = state
+	}
+
+	if state.status != info.Status {
+		backend := name
+		if backend == "" {
+			backend = r.app
+		}
+
+		t := HealthTransition{
+			Backend: backend,
+			From:    state.status,
+			To:      info.Status,
+			Time:    now,
+			Error:   info.Error,
+		}
+		transitions = append(transitions, t)
+
+		if r.historySize > 0 {
+			history := append(r.history[backend], t)
+			if len(history) > r.historySize {
+				history = history[len(history)-r.historySize:]
+			}
+			r.history[backend] = history
+		}
+
+		state.status = info.Status
+		state.lastChange = now
+	}
+	if info.Status == StatusUnhealthy {
+		state.failures++
+	} else {
+		state.failures = 0
+	}
+
+	lastChange := state.lastChange
+	info.LastChange = &lastChange
+	info.ConsecutiveFailures = state.failures
+
+	return transitions
+}
+
+// run executes the check, giving up once the timeout expired, even if the
+// check does not respect its context.
+func (c registeredHealthCheck) run() HealthInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- errgo.Newf("check panicked: %v", r)
+			}
+		}()
+		result <- c.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = errgo.Newf("check timed out after %s", c.options.Timeout)
+	}
+
+	info := HealthInfo{
+		Name:        c.name,
+		Status:      StatusHealthy,
+		Backends:    []HealthInfo{},
+		Duration:    float64(time.Since(start)) / float64(time.Millisecond),
+		NonCritical: c.options.NonCritical,
+	}
+	if err != nil {
+		info.Status = StatusUnhealthy
+		info.Error = err.Error()
+	}
+
+	return info
+}
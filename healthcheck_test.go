@@ -1,7 +1,21 @@
 package server_test
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -16,17 +30,15 @@ func TestHealtcheck(t *testing.T) {
 
 var _ = Describe("healtcheck", func() {
 	var (
-		err    error
-		status string
-		hc     srvPkg.Healthchecker
-		info   srvPkg.HealthInfo
+		err  error
+		hc   srvPkg.Healthchecker
+		info srvPkg.HealthInfo
 
 		expectedStatus string
 	)
 
 	BeforeEach(func() {
 		err = nil
-		status = ""
 
 		hc = func() (srvPkg.HealthInfo, error) {
 			return info, nil
@@ -43,6 +55,7 @@ var _ = Describe("healtcheck", func() {
 	AfterEach(func() {
 		info, err = hc.Status()
 
+		Expect(err).To(BeNil())
 		Expect(info.Status).To(Equal(expectedStatus))
 	})
 
@@ -94,5 +107,732 @@ var _ = Describe("healtcheck", func() {
 				expectedStatus = srvPkg.StatusUnhealthy
 			})
 		})
+
+		Context("healthy service having unhealthy non-critical backends", func() {
+			It("should calculate status degraded", func() {
+				info.Status = srvPkg.StatusHealthy
+				info.Backends = []srvPkg.HealthInfo{
+					srvPkg.HealthInfo{Status: srvPkg.StatusHealthy},
+					srvPkg.HealthInfo{Status: srvPkg.StatusUnhealthy, NonCritical: true}, // unhealthy cache
+				}
+
+				expectedStatus = srvPkg.StatusDegraded
+			})
+		})
+
+		Context("healthy service having unhealthy critical and non-critical backends", func() {
+			It("should calculate status unhealthy", func() {
+				info.Status = srvPkg.StatusHealthy
+				info.Backends = []srvPkg.HealthInfo{
+					srvPkg.HealthInfo{Status: srvPkg.StatusUnhealthy, NonCritical: true}, // unhealthy cache
+					srvPkg.HealthInfo{Status: srvPkg.StatusUnhealthy},                    // unhealthy database
+				}
+
+				expectedStatus = srvPkg.StatusUnhealthy
+			})
+		})
+
+		Context("healthy service having degraded critical backends", func() {
+			It("should calculate status degraded", func() {
+				info.Status = srvPkg.StatusHealthy
+				info.Backends = []srvPkg.HealthInfo{
+					srvPkg.HealthInfo{
+						Status: srvPkg.StatusHealthy,
+						Backends: []srvPkg.HealthInfo{
+							srvPkg.HealthInfo{Status: srvPkg.StatusUnhealthy, NonCritical: true},
+						},
+					},
+				}
+
+				expectedStatus = srvPkg.StatusDegraded
+			})
+		})
+
+		Context("degraded service having healthy backends", func() {
+			It("should calculate status degraded", func() {
+				info.Status = srvPkg.StatusDegraded
+				info.Backends = []srvPkg.HealthInfo{
+					srvPkg.HealthInfo{Status: srvPkg.StatusHealthy},
+				}
+
+				expectedStatus = srvPkg.StatusDegraded
+			})
+		})
+
+		Context("healthy service having non-critical backends with unhealthy backends", func() {
+			It("should calculate status degraded", func() {
+				info.Status = srvPkg.StatusHealthy
+				info.Backends = []srvPkg.HealthInfo{
+					srvPkg.HealthInfo{
+						Status:      srvPkg.StatusHealthy,
+						NonCritical: true,
+						Backends: []srvPkg.HealthInfo{
+							srvPkg.HealthInfo{Status: srvPkg.StatusUnhealthy},
+						},
+					},
+				}
+
+				expectedStatus = srvPkg.StatusDegraded
+			})
+		})
+	})
+})
+
+var _ = Describe("healthcheck middleware", func() {
+	var (
+		srv  *srvPkg.Server
+		info srvPkg.HealthInfo
+	)
+
+	BeforeEach(func() {
+		info = srvPkg.HealthInfo{Status: srvPkg.StatusHealthy}
+
+		srv = srvPkg.NewServer("", "")
+		srv.SetAccessReporter(nil)
+		srv.Serve("GET", "/healthcheck", srvPkg.NewHealthcheckMiddleware(func() (srvPkg.HealthInfo, error) {
+			return info, nil
+		}))
+	})
+
+	It("should respond 200 for degraded services", func() {
+		info.Backends = []srvPkg.HealthInfo{{Status: srvPkg.StatusUnhealthy, NonCritical: true}}
+
+		res := serve(srv, httptest.NewRequest("GET", "/healthcheck", nil))
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring(`"status":"degraded"`))
+	})
+
+	It("should respond 503 for unhealthy services", func() {
+		info.Backends = []srvPkg.HealthInfo{{Status: srvPkg.StatusUnhealthy}}
+
+		res := serve(srv, httptest.NewRequest("GET", "/healthcheck", nil))
+		Expect(res.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(res.Body.String()).To(ContainSubstring(`"status":"unhealthy"`))
+	})
+
+	Describe("formats", func() {
+		BeforeEach(func() {
+			info.App = "test-app"
+			info.Version = "test-version"
+			info.Backends = []srvPkg.HealthInfo{
+				{Name: "database", Status: srvPkg.StatusHealthy, Duration: 12},
+				{Name: "cache", Status: srvPkg.StatusUnhealthy, Error: "connection refused", NonCritical: true, ConsecutiveFailures: 3},
+			}
+		})
+
+		It("should respond IETF health+json if accepted", func() {
+			req := httptest.NewRequest("GET", "/healthcheck", nil)
+			req.Header.Set("Accept", "application/health+json, application/json;q=0.9")
+			res := serve(srv, req)
+
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).To(Equal(srvPkg.HealthJSONContentType))
+
+			var report srvPkg.HealthJSON
+			Expect(json.Unmarshal(res.Body.Bytes(), &report)).To(BeNil())
+			Expect(report.Status).To(Equal("warn"))
+			Expect(report.ServiceID).To(Equal("test-app"))
+			Expect(report.ReleaseID).To(Equal("test-version"))
+			Expect(report.Checks["database:responseTime"]).To(HaveLen(1))
+			Expect(*report.Checks["database:responseTime"][0].ObservedValue).To(Equal(12.0))
+			Expect(report.Checks["cache:responseTime"][0].Status).To(Equal("fail"))
+			Expect(report.Checks["cache:responseTime"][0].Output).To(Equal("connection refused"))
+		})
+
+		It("should respond Prometheus gauges if requested by query parameter", func() {
+			res := serve(srv, httptest.NewRequest("GET", "/healthcheck?format=prometheus", nil))
+
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).To(Equal(srvPkg.MetricsContentType))
+			body := res.Body.String()
+			Expect(body).To(ContainSubstring(`health_status{app="test-app",version="test-version",status="degraded"} 1`))
+			Expect(body).To(ContainSubstring(`health_backend_status{app="test-app",backend="database",status="healthy"} 1`))
+			Expect(body).To(ContainSubstring(`health_backend_status{app="test-app",backend="cache",status="healthy"} 0`))
+			Expect(body).To(ContainSubstring(`health_backend_duration_seconds{app="test-app",backend="database"} 0.012`))
+			Expect(body).To(ContainSubstring(`health_backend_consecutive_failures{app="test-app",backend="cache"} 3`))
+		})
+
+		It("should respond JSON by default", func() {
+			req := httptest.NewRequest("GET", "/healthcheck", nil)
+			req.Header.Set("Accept", "*/*")
+			res := serve(srv, req)
+
+			Expect(res.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(res.Body.String()).To(ContainSubstring(`"status":"degraded"`))
+		})
+
+		It("should reject unknown formats", func() {
+			res := serve(srv, httptest.NewRequest("GET", "/healthcheck?format=xml", nil))
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
+
+var _ = Describe("health registry", func() {
+	var registry *srvPkg.HealthRegistry
+
+	BeforeEach(func() {
+		registry = srvPkg.NewHealthRegistry("test-app", "test-version")
+	})
+
+	It("should report every backend", func() {
+		registry.Register("database", func(ctx context.Context) error {
+			return nil
+		}, srvPkg.HealthCheckOptions{})
+		registry.Register("cache", func(ctx context.Context) error {
+			return errors.New("connection refused")
+		}, srvPkg.HealthCheckOptions{})
+
+		info, err := registry.Check()
+		Expect(err).To(BeNil())
+		Expect(info.App).To(Equal("test-app"))
+		Expect(info.Status).To(Equal(srvPkg.StatusUnhealthy))
+		Expect(info.Backends).To(HaveLen(2))
+
+		Expect(info.Backends[0].Name).To(Equal("database"))
+		Expect(info.Backends[0].Status).To(Equal(srvPkg.StatusHealthy))
+		Expect(info.Backends[1].Name).To(Equal("cache"))
+		Expect(info.Backends[1].Status).To(Equal(srvPkg.StatusUnhealthy))
+		Expect(info.Backends[1].Error).To(Equal("connection refused"))
+	})
+
+	It("should report failing non-critical backends as degraded", func() {
+		registry.Register("cache", func(ctx context.Context) error {
+			return errors.New("connection refused")
+		}, srvPkg.HealthCheckOptions{NonCritical: true})
+
+		info, err := registry.Check()
+		Expect(err).To(BeNil())
+		Expect(info.Status).To(Equal(srvPkg.StatusDegraded))
+		Expect(info.Backends[0].NonCritical).To(BeTrue())
+	})
+
+	It("should run checks in parallel with their own timeout", func() {
+		block := make(chan struct{})
+		defer close(block)
+
+		for _, name := range []string{"a", "b", "c"} {
+			registry.Register(name, func(ctx context.Context) error {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			}, srvPkg.HealthCheckOptions{})
+		}
+		registry.Register("hanging", func(ctx context.Context) error {
+			<-block
+			return nil
+		}, srvPkg.HealthCheckOptions{Timeout: 100 * time.Millisecond})
+
+		start := time.Now()
+		info, err := registry.Check()
+		Expect(err).To(BeNil())
+		Expect(time.Since(start)).To(BeNumerically("<", 140*time.Millisecond))
+
+		Expect(info.Status).To(Equal(srvPkg.StatusUnhealthy))
+		Expect(info.Backends[0].Status).To(Equal(srvPkg.StatusHealthy))
+		Expect(info.Backends[0].Duration).To(BeNumerically(">=", 50))
+		Expect(info.Backends[3].Error).To(ContainSubstring("timed out"))
+	})
+
+	Describe("caching", func() {
+		var (
+			runs    int32
+			failing int32
+		)
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&runs, 0)
+			atomic.StoreInt32(&failing, 0)
+			registry.Register("database", func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				if atomic.LoadInt32(&failing) == 1 {
+					return errors.New("connection refused")
+				}
+				return nil
+			}, srvPkg.HealthCheckOptions{})
+		})
+
+		It("should run checks on every call without TTL", func() {
+			registry.Check()
+			registry.Check()
+
+			Expect(atomic.LoadInt32(&runs)).To(Equal(int32(2)))
+		})
+
+		It("should share runs in progress between concurrent calls without TTL", func() {
+			registry.Register("slow", func(ctx context.Context) error {
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			}, srvPkg.HealthCheckOptions{})
+
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					info, err := registry.Check()
+					Expect(err).To(BeNil())
+					Expect(info.Status).To(Equal(srvPkg.StatusHealthy))
+				}()
+			}
+			wg.Wait()
+
+			// Serialized runs would take 10 times as long.
+			Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+			Expect(atomic.LoadInt32(&runs)).To(BeNumerically("<", 10))
+		})
+
+		It("should serve results from the cache until the TTL expired", func() {
+			registry.SetCacheTTL(50 * time.Millisecond)
+			registry.Check()
+			registry.Check()
+			Expect(atomic.LoadInt32(&runs)).To(Equal(int32(1)))
+
+			registry.CheckFresh()
+			Expect(atomic.LoadInt32(&runs)).To(Equal(int32(2)))
+
+			time.Sleep(60 * time.Millisecond)
+			registry.Check()
+			Expect(atomic.LoadInt32(&runs)).To(Equal(int32(3)))
+		})
+
+		It("should refresh results in the background", func() {
+			registry.SetCacheTTL(time.Minute)
+			registry.StartRefresh(10 * time.Millisecond)
+			defer registry.Close()
+
+			Eventually(func() int32 {
+				return atomic.LoadInt32(&runs)
+			}).Should(BeNumerically(">=", 3))
+
+			registry.Check()
+		})
+
+		It("should track status changes and consecutive failures", func() {
+			first, _ := registry.Check()
+			Expect(first.Backends[0].LastChange).NotTo(BeNil())
+			Expect(first.Backends[0].ConsecutiveFailures).To(Equal(0))
+
+			atomic.StoreInt32(&failing, 1)
+			registry.Check()
+			info, _ := registry.Check()
+			Expect(info.Status).To(Equal(srvPkg.StatusUnhealthy))
+			Expect(info.Backends[0].ConsecutiveFailures).To(Equal(2))
+			Expect(info.Backends[0].LastChange.After(*first.Backends[0].LastChange)).To(BeTrue())
+
+			atomic.StoreInt32(&failing, 0)
+			info, _ = registry.Check()
+			Expect(info.Backends[0].ConsecutiveFailures).To(Equal(0))
+		})
+	})
+
+	Describe("history", func() {
+		var (
+			failing     int32
+			transitions chan srvPkg.HealthTransition
+			logger      *srvPkg.RecordingLogger
+		)
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&failing, 0)
+			registry.Register("database", func(ctx context.Context) error {
+				if atomic.LoadInt32(&failing) == 1 {
+					return errors.New("connection refused")
+				}
+				return nil
+			}, srvPkg.HealthCheckOptions{})
+
+			transitions = make(chan srvPkg.HealthTransition, 100)
+			registry.OnChange(func(t srvPkg.HealthTransition) {
+				transitions <- t
+			})
+
+			logger = srvPkg.NewRecordingLogger()
+			registry.SetLogger(logger)
+		})
+
+		flap := func(times int) {
+			registry.Check()
+			for i := 0; i < times; i++ {
+				atomic.StoreInt32(&failing, 1)
+				registry.Check()
+				atomic.StoreInt32(&failing, 0)
+				registry.Check()
+			}
+		}
+
+		It("should record transitions of backends and the service", func() {
+			flap(1)
+
+			history := registry.History()
+			Expect(history["database"]).To(HaveLen(2))
+			Expect(history["database"][0].From).To(Equal(srvPkg.StatusHealthy))
+			Expect(history["database"][0].To).To(Equal(srvPkg.StatusUnhealthy))
+			Expect(history["database"][0].Error).To(Equal("connection refused"))
+			Expect(history["database"][1].To).To(Equal(srvPkg.StatusHealthy))
+			Expect(history["test-app"]).To(HaveLen(2))
+		})
+
+		It("should keep the configured number of transitions", func() {
+			registry.SetHistorySize(3)
+			flap(5)
+
+			history := registry.History()
+			Expect(history["database"]).To(HaveLen(3))
+			Expect(history["database"][2].To).To(Equal(srvPkg.StatusHealthy))
+		})
+
+		It("should keep no transitions for a size of zero or less", func() {
+			flap(1)
+			registry.SetHistorySize(-1)
+			Expect(registry.History()).To(BeEmpty())
+
+			flap(2)
+			Expect(registry.History()).To(BeEmpty())
+			Expect(transitions).To(HaveLen(12))
+
+			_, err := registry.Check()
+			Expect(err).To(BeNil())
+		})
+
+		It("should keep the history of the service apart from backends", func() {
+			Expect(func() {
+				registry.Register("test-app", func(ctx context.Context) error { return nil }, srvPkg.HealthCheckOptions{})
+			}).To(Panic())
+			Expect(func() {
+				registry.Register("", func(ctx context.Context) error { return nil }, srvPkg.HealthCheckOptions{})
+			}).To(Panic())
+		})
+
+		It("should notify callbacks and log transitions", func() {
+			flap(1)
+
+			Expect(transitions).To(HaveLen(4))
+			t := <-transitions
+			Expect(t.Backend).To(Equal("database"))
+			Expect(t.To).To(Equal(srvPkg.StatusUnhealthy))
+
+			records := logger.Records()
+			Expect(records).To(HaveLen(4))
+			Expect(records[0].Level).To(Equal("WARNING"))
+			Expect(records[0].Fields).To(HaveKeyWithValue("backend", "database"))
+		})
+
+		It("should post transitions to webhooks", func() {
+			posted := make(chan srvPkg.HealthTransition, 10)
+			ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				var t srvPkg.HealthTransition
+				json.NewDecoder(req.Body).Decode(&t)
+				posted <- t
+			}))
+			defer ts.Close()
+
+			registry.AddWebhook(ts.URL)
+			registry.Check()
+			atomic.StoreInt32(&failing, 1)
+			registry.Check()
+
+			Eventually(posted).Should(HaveLen(2))
+		})
+
+		It("should serve the history", func() {
+			srv := srvPkg.NewServer("", "")
+			srv.SetAccessReporter(nil)
+			srv.Serve("GET", "/healthcheck/history", srvPkg.NewHealthHistoryMiddleware(registry))
+			flap(1)
+
+			res := serve(srv, httptest.NewRequest("GET", "/healthcheck/history", nil))
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			var history map[string][]srvPkg.HealthTransition
+			Expect(json.Unmarshal(res.Body.Bytes(), &history)).To(BeNil())
+			Expect(history["database"]).To(HaveLen(2))
+		})
+	})
+
+	It("should report panicking checks as unhealthy", func() {
+		registry.Register("broken", func(ctx context.Context) error {
+			panic("oops")
+		}, srvPkg.HealthCheckOptions{})
+
+		info, err := registry.Check()
+		Expect(err).To(BeNil())
+		Expect(info.Backends[0].Status).To(Equal(srvPkg.StatusUnhealthy))
+		Expect(info.Backends[0].Error).To(ContainSubstring("oops"))
+	})
+})
+
+var _ = Describe("probes", func() {
+	var (
+		srv     *srvPkg.Server
+		healthy bool
+	)
+
+	BeforeEach(func() {
+		healthy = true
+		hc := func() (srvPkg.HealthInfo, error) {
+			if !healthy {
+				return srvPkg.HealthInfo{Status: srvPkg.StatusUnhealthy, Error: "database down"}, nil
+			}
+			return srvPkg.HealthInfo{Status: srvPkg.StatusHealthy}, nil
+		}
+
+		srv = srvPkg.NewServer("", "")
+		srv.SetAccessReporter(nil)
+		srv.Serve("GET", "/livez", srvPkg.NewLivenessMiddleware(nil))
+		srv.Serve("GET", "/readyz", srvPkg.NewReadinessMiddleware(srv, hc))
+		srv.Serve("GET", "/startupz", srvPkg.NewStartupMiddleware(srv))
+	})
+
+	get := func(url string) *httptest.ResponseRecorder {
+		return serve(srv, httptest.NewRequest("GET", url, nil))
+	}
+
+	It("should answer liveness probes", func() {
+		res := get("/livez")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(Equal("healthy\n"))
+	})
+
+	It("should fail readiness probes while unhealthy", func() {
+		Expect(get("/readyz").Code).To(Equal(http.StatusOK))
+
+		healthy = false
+		res := get("/readyz?verbose")
+		Expect(res.Code).To(Equal(http.StatusServiceUnavailable))
+
+		var info srvPkg.HealthInfo
+		Expect(json.Unmarshal(res.Body.Bytes(), &info)).To(BeNil())
+		Expect(info.Status).To(Equal(srvPkg.StatusUnhealthy))
+		Expect(info.Error).To(Equal("database down"))
+	})
+
+	Context("with initializers", func() {
+		var release chan struct{}
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			srv.AddInitializer("cache", func(ctx context.Context) error {
+				<-release
+				return nil
+			})
+		})
+
+		It("should fail startup and readiness probes until initialized", func() {
+			done := make(chan error)
+			go func() {
+				done <- srv.RunInitializers(context.Background())
+			}()
+
+			Expect(get("/startupz").Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(get("/readyz").Code).To(Equal(http.StatusServiceUnavailable))
+
+			var info srvPkg.HealthInfo
+			Expect(json.Unmarshal(get("/startupz?verbose").Body.Bytes(), &info)).To(BeNil())
+			Expect(info.Backends).To(HaveLen(1))
+			Expect(info.Backends[0].Name).To(Equal("cache"))
+			Expect(info.Backends[0].Error).To(Equal("pending"))
+
+			close(release)
+			Expect(<-done).To(BeNil())
+
+			Expect(get("/startupz").Code).To(Equal(http.StatusOK))
+			Expect(get("/readyz").Code).To(Equal(http.StatusOK))
+		})
+
+		It("should keep failing the startup probe if an initializer failed", func() {
+			close(release)
+			srv.AddInitializer("migrations", func(ctx context.Context) error {
+				return errors.New("migration failed")
+			})
+
+			Expect(srv.RunInitializers(context.Background())).NotTo(BeNil())
+			Expect(get("/startupz").Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+})
+
+// stubDriver is a database/sql driver whose connections fail to ping if
+// pingErr is set.
+type stubDriver struct {
+	pingErr error
+}
+
+func (d *stubDriver) Open(name string) (driver.Conn, error) {
+	return &stubConn{driver: d}, nil
+}
+
+type stubConn struct {
+	driver *stubDriver
+}
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *stubConn) Close() error {
+	return nil
+}
+
+func (c *stubConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *stubConn) Ping(ctx context.Context) error {
+	return c.driver.pingErr
+}
+
+var stubSQLDriver = &stubDriver{}
+
+func init() {
+	sql.Register("healthcheck-stub", stubSQLDriver)
+}
+
+var _ = Describe("health checkers", func() {
+	ctx := context.Background()
+
+	Describe("HTTP", func() {
+		var ts *httptest.Server
+
+		BeforeEach(func() {
+			ts = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/down" {
+					http.Error(res, "down", http.StatusInternalServerError)
+					return
+				}
+				res.Write([]byte(`{"status": "ok"}`))
+			}))
+		})
+
+		AfterEach(func() {
+			ts.Close()
+		})
+
+		It("should succeed for 2xx responses", func() {
+			Expect(srvPkg.HTTPHealthCheck(ts.URL, srvPkg.HTTPCheckOptions{})(ctx)).To(BeNil())
+		})
+
+		It("should fail for other responses", func() {
+			err := srvPkg.HTTPHealthCheck(ts.URL+"/down", srvPkg.HTTPCheckOptions{})(ctx)
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("got 500"))
+		})
+
+		It("should check the expected status and body", func() {
+			Expect(srvPkg.HTTPHealthCheck(ts.URL+"/down", srvPkg.HTTPCheckOptions{Status: 500})(ctx)).To(BeNil())
+			Expect(srvPkg.HTTPHealthCheck(ts.URL, srvPkg.HTTPCheckOptions{BodyContains: `"ok"`})(ctx)).To(BeNil())
+			Expect(srvPkg.HTTPHealthCheck(ts.URL, srvPkg.HTTPCheckOptions{BodyContains: "ready"})(ctx)).NotTo(BeNil())
+		})
+
+		It("should reuse connections", func() {
+			var conns int32
+			// The body must exceed what the transport drains itself on close,
+			// so the connection is only reused if the check reads it.
+			reused := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.WriteHeader(http.StatusInternalServerError)
+				res.Write(make([]byte, 512<<10))
+			}))
+			reused.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&conns, 1)
+				}
+			}
+			reused.Start()
+			defer reused.Close()
+
+			check := srvPkg.HTTPHealthCheck(reused.URL, srvPkg.HTTPCheckOptions{
+				Client: &http.Client{Transport: &http.Transport{}},
+			})
+			for i := 0; i < 3; i++ {
+				Expect(check(ctx)).NotTo(BeNil())
+			}
+			Expect(atomic.LoadInt32(&conns)).To(Equal(int32(1)))
+		})
+	})
+
+	Describe("TCP", func() {
+		It("should succeed if the port is open", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			defer l.Close()
+
+			Expect(srvPkg.TCPHealthCheck(l.Addr().String())(ctx)).To(BeNil())
+		})
+
+		It("should fail if the port is closed", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			addr := l.Addr().String()
+			l.Close()
+
+			Expect(srvPkg.TCPHealthCheck(addr)(ctx)).NotTo(BeNil())
+		})
+	})
+
+	Describe("DNS", func() {
+		It("should resolve hosts", func() {
+			Expect(srvPkg.DNSHealthCheck("localhost")(ctx)).To(BeNil())
+		})
+
+		It("should fail for invalid hosts", func() {
+			Expect(srvPkg.DNSHealthCheck("host.invalid")(ctx)).NotTo(BeNil())
+		})
+	})
+
+	Describe("disk free", func() {
+		It("should compare the available space", func() {
+			Expect(srvPkg.DiskFreeHealthCheck(".", 1)(ctx)).To(BeNil())
+			Expect(srvPkg.DiskFreeHealthCheck(".", 1<<62)(ctx)).NotTo(BeNil())
+		})
+	})
+
+	Describe("SQL", func() {
+		var db *sql.DB
+
+		BeforeEach(func() {
+			var err error
+			db, err = sql.Open("healthcheck-stub", "")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			stubSQLDriver.pingErr = nil
+			db.Close()
+		})
+
+		It("should ping the database", func() {
+			Expect(srvPkg.SQLHealthCheck(db)(ctx)).To(BeNil())
+
+			stubSQLDriver.pingErr = errors.New("connection refused")
+			Expect(srvPkg.SQLHealthCheck(db)(ctx)).NotTo(BeNil())
+		})
+	})
+
+	Describe("file", func() {
+		It("should check the existence", func() {
+			dir, err := ioutil.TempDir("", "healthcheck")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "ready")
+			Expect(srvPkg.FileHealthCheck(path)(ctx)).NotTo(BeNil())
+
+			Expect(ioutil.WriteFile(path, nil, 0644)).To(BeNil())
+			Expect(srvPkg.FileHealthCheck(path)(ctx)).To(BeNil())
+		})
+	})
+
+	Describe("runtime", func() {
+		It("should compare the goroutines", func() {
+			Expect(srvPkg.GoroutinesHealthCheck(100000)(ctx)).To(BeNil())
+			Expect(srvPkg.GoroutinesHealthCheck(0)(ctx)).NotTo(BeNil())
+		})
+
+		It("should compare the heap size", func() {
+			Expect(srvPkg.HeapHealthCheck(1 << 40)(ctx)).To(BeNil())
+			Expect(srvPkg.HeapHealthCheck(1)(ctx)).NotTo(BeNil())
+		})
 	})
 })
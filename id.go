@@ -1,16 +1,111 @@
 package server
 
 import (
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
 	"github.com/dchest/uniuri"
 )
 
 const (
 	requestIDFactoryLen   = 16
 	requestIDFactoryChars = `abcdefghijklmnopqrstuvwxyz0123456789`
+
+	ulidChars = `0123456789ABCDEFGHJKMNPQRSTVWXYZ`
 )
 
+// NewIDFactory creates IDs of 16 random lowercase characters and digits, e.g.
+// "cu2jdtczhimlb3y7". This is the default of `Server.IDFactory`.
 func NewIDFactory() func() string {
 	return func() string {
 		return uniuri.NewLenChars(requestIDFactoryLen, []byte(requestIDFactoryChars))
 	}
 }
+
+// NewUUIDv4Factory creates random UUIDs, e.g.
+// "3b241101-e2bb-4255-8caf-4136c566a962".
+func NewUUIDv4Factory() func() string {
+	return func() string {
+		var id [16]byte
+		randomID(id[:])
+
+		id[6] = id[6]&0x0f | 0x40
+		id[8] = id[8]&0x3f | 0x80
+
+		return formatUUID(id)
+	}
+}
+
+// NewUUIDv7Factory creates UUIDs starting with the current time in
+// milliseconds, so IDs sort by creation time, e.g.
+// "01890a5d-ac96-774b-bcce-b302099a8057".
+func NewUUIDv7Factory() func() string {
+	return func() string {
+		var id [16]byte
+		putMillis(id[:], time.Now())
+		randomID(id[6:])
+
+		id[6] = id[6]&0x0f | 0x70
+		id[8] = id[8]&0x3f | 0x80
+
+		return formatUUID(id)
+	}
+}
+
+// NewULIDFactory creates ULIDs, 26 characters starting with the current time
+// in milliseconds, so IDs sort by creation time, e.g.
+// "01ARZ3NDEKTSV4RRFFQ69G5FAV".
+func NewULIDFactory() func() string {
+	return func() string {
+		var id [16]byte
+		putMillis(id[:], time.Now())
+		randomID(id[6:])
+
+		return formatULID(id)
+	}
+}
+
+//------------------------------------------------------------------------------
+// private
+
+// putMillis writes the unix time of t in milliseconds into the first 6 bytes
+// of b.
+func putMillis(b []byte, t time.Time) {
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixNano()/int64(time.Millisecond)))
+	copy(b[:6], ms[2:])
+}
+
+func formatUUID(id [16]byte) string {
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+
+	return string(buf)
+}
+
+// formatULID encodes the 128 bits of id as 26 characters of Crockford's
+// base32, each encoding 5 bits. The first character only encodes 3 bits.
+func formatULID(id [16]byte) string {
+	buf := make([]byte, 26)
+	for i := range buf {
+		var value byte
+		for bit := i*5 - 2; bit < i*5+3; bit++ {
+			value <<= 1
+			if bit >= 0 && id[bit/8]&(0x80>>uint(bit%8)) != 0 {
+				value |= 1
+			}
+		}
+		buf[i] = ulidChars[value]
+	}
+
+	return string(buf)
+}
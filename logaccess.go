@@ -2,25 +2,44 @@ package server
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/giantswarm/request-context"
-	"github.com/gorilla/mux"
 )
 
 // Code heavily inspired by https://github.com/streadway/handy/blob/master/report/
 
 type AccessEntry struct {
+	start         time.Time
 	routeName     string
 	requestMethod string
 	requestURI    string
 	request       *http.Request
+	clientIP      net.IP
+	requestSize   int64
 
-	duration   time.Duration
-	statusCode int
-	size       int64
+	duration        time.Duration
+	timeToFirstByte time.Duration
+	statusCode      int
+	size            int64
+	contentRange    string
+
+	mutex       sync.Mutex
+	principal   string
+	annotations map[string]string
+
+	debug *debugRecorder
+}
+
+// Start returns the time the request was received.
+func (ae *AccessEntry) Start() time.Time {
+	return ae.start
 }
 
 func (ae *AccessEntry) RouteName() string {
@@ -39,10 +58,82 @@ func (ae *AccessEntry) Request() *http.Request {
 	return ae.request
 }
 
+// ClientIP returns the IP of the client. If the request passed trusted
+// proxies, this is the IP reported by them, see `Server.SetTrustedProxies`.
+func (ae *AccessEntry) ClientIP() net.IP {
+	return ae.clientIP
+}
+
+// RequestSize returns the number of bytes of the request body read by the
+// middlewares.
+func (ae *AccessEntry) RequestSize() int64 {
+	return ae.requestSize
+}
+
+// Protocol returns the protocol version of the request, e.g. "HTTP/1.1".
+func (ae *AccessEntry) Protocol() string {
+	return ae.request.Proto
+}
+
+// TLS returns the state of the TLS connection the request was received on,
+// or nil.
+func (ae *AccessEntry) TLS() *tls.ConnectionState {
+	return ae.request.TLS
+}
+
+// TLSVersion returns the TLS version the request was received with, e.g.
+// "TLS 1.3", or an empty string.
+func (ae *AccessEntry) TLSVersion() string {
+	if ae.request.TLS == nil {
+		return ""
+	}
+
+	return tlsVersionName(ae.request.TLS.Version)
+}
+
+// TLSCipherSuite returns the cipher suite the request was received with, or
+// an empty string.
+func (ae *AccessEntry) TLSCipherSuite() string {
+	if ae.request.TLS == nil {
+		return ""
+	}
+
+	return tls.CipherSuiteName(ae.request.TLS.CipherSuite)
+}
+
+// Principal returns the authenticated principal set by a middleware using
+// `Context.SetPrincipal`.
+func (ae *AccessEntry) Principal() string {
+	ae.mutex.Lock()
+	defer ae.mutex.Unlock()
+
+	return ae.principal
+}
+
+// Annotations returns a copy of the key/value pairs added by middlewares
+// using `Context.Annotate`.
+func (ae *AccessEntry) Annotations() map[string]string {
+	ae.mutex.Lock()
+	defer ae.mutex.Unlock()
+
+	annotations := make(map[string]string, len(ae.annotations))
+	for k, v := range ae.annotations {
+		annotations[k] = v
+	}
+
+	return annotations
+}
+
 func (ae *AccessEntry) Duration() time.Duration {
 	return ae.duration
 }
 
+// TimeToFirstByte returns the time from receiving the request until the
+// status code or the first bytes of the body were written.
+func (ae *AccessEntry) TimeToFirstByte() time.Duration {
+	return ae.timeToFirstByte
+}
+
 func (ae *AccessEntry) StatusCode() int {
 	return ae.statusCode
 }
@@ -51,9 +142,46 @@ func (ae *AccessEntry) Size() int64 {
 	return ae.size
 }
 
+// Partial returns true if only parts of the requested content were sent, as
+// requested using the Range header.
+func (ae *AccessEntry) Partial() bool {
+	return ae.statusCode == http.StatusPartialContent
+}
+
+// Debug returns the headers and bodies captured for the request, if debug
+// logging was enabled for it using `Server.SetDebugLogging`, or nil.
+func (ae *AccessEntry) Debug() *DebugCapture {
+	if ae.debug == nil {
+		return nil
+	}
+
+	return ae.debug.capture
+}
+
+// ContentRange returns the Content-Range header sent with the response, e.g.
+// "bytes 0-1023/4096" for partial content.
+func (ae *AccessEntry) ContentRange() string {
+	return ae.contentRange
+}
+
 type accessEntryWriter struct {
 	http.ResponseWriter
-	entry *AccessEntry
+	entry   *AccessEntry
+	written bool
+}
+
+// Written returns true once the status code or parts of the body were sent.
+func (e *accessEntryWriter) Written() bool {
+	return e.written
+}
+
+// Status returns the status code sent, or 0 if nothing was written yet.
+func (e *accessEntryWriter) Status() int {
+	if !e.written {
+		return 0
+	}
+
+	return e.entry.statusCode
 }
 
 // Flush proxies http.Flusher's functionality if it is available on ResponseWriter
@@ -71,17 +199,43 @@ func (e *accessEntryWriter) CloseNotify() <-chan bool {
 
 // Write sums the writes to produce the actual number of bytes written
 func (e *accessEntryWriter) Write(b []byte) (int, error) {
+	if !e.written {
+		e.written = true
+		e.entry.timeToFirstByte = time.Since(e.entry.start)
+		e.captureHeader()
+	}
+
 	n, err := e.ResponseWriter.Write(b)
 	e.entry.size += int64(n)
+	if e.entry.debug != nil {
+		e.entry.debug.responseBody.Write(b[:n])
+	}
 	return n, err
 }
 
-// WriteHeader captures the status code and writes through to the wrapper ResponseWriter.
+// WriteHeader captures the status code and writes through to the wrapper
+// ResponseWriter. Superfluous calls are dropped, so the status code reported
+// is the one actually sent.
 func (e *accessEntryWriter) WriteHeader(code int) {
+	if e.written {
+		return
+	}
+
+	e.written = true
+	e.entry.timeToFirstByte = time.Since(e.entry.start)
 	e.entry.statusCode = code
+	e.entry.contentRange = e.ResponseWriter.Header().Get("Content-Range")
+	e.captureHeader()
 	e.ResponseWriter.WriteHeader(code)
 }
 
+// captureHeader records the headers sent, if debug logging is enabled.
+func (e *accessEntryWriter) captureHeader() {
+	if e.entry.debug != nil {
+		e.entry.debug.responseHeader = e.ResponseWriter.Header().Clone()
+	}
+}
+
 // Hijack lets the caller take over the connection.
 // After a call to Hijack(), the HTTP server library
 // will not do anything else with the connection.
@@ -95,32 +249,37 @@ func (e *accessEntryWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 // NewLogAccessHandler executes the next handler and logs the requests statistics afterwards to the logger.
 func NewLogAccessHandler(reporter, preHTTP, postHTTP AccessReporter, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(response http.ResponseWriter, req *http.Request) {
+		start := time.Now()
 		entry := AccessEntry{
+			start:         start,
 			requestMethod: req.Method,
 			requestURI:    req.RequestURI,
 
 			request:    req,
+			clientIP:   remoteIP(req),
 			statusCode: 200,
 		}
-		start := time.Now()
 
 		if preHTTP != nil {
 			preHTTP(&entry)
 		}
 
-		next.ServeHTTP(&accessEntryWriter{response, &entry}, req)
-
-		// Note, fetching a routes name needs to be done AFTER the routers handler
-		// is executed. Otherwise the correct mux context is not given.
-		route := mux.CurrentRoute(req)
-		if route != nil {
-			entry.routeName = route.GetName()
+		// Make the entry available to the middlewares, see accessEntryFromRequest.
+		req = req.WithContext(context.WithValue(req.Context(), accessEntryKey{}, &entry))
+		if req.Body != nil && req.Body != http.NoBody {
+			req.Body = &countingReadCloser{ReadCloser: req.Body, n: &entry.requestSize}
 		}
 
-		if entry.routeName == "" {
-			entry.routeName = req.Method + " route-not-found"
+		next.ServeHTTP(&accessEntryWriter{ResponseWriter: response, entry: &entry}, req)
+
+		if entry.debug != nil {
+			entry.debug.finish(response)
 		}
 
+		// Note, fetching a routes name needs to be done AFTER the routers handler
+		// is executed. Otherwise the correct mux context is not given.
+		entry.routeName = currentRouteName(req)
+
 		entry.duration = time.Since(start)
 
 		if postHTTP != nil {
@@ -133,17 +292,102 @@ func NewLogAccessHandler(reporter, preHTTP, postHTTP AccessReporter, next http.H
 
 type AccessReporter func(entry *AccessEntry)
 
-func DefaultAccessReporter(ctx requestcontext.Ctx, logger requestcontext.Logger) AccessReporter {
+// AccessReporterFactory creates the AccessReporter for a single request. The
+// given context contains the request ID, the logger is the one of the server
+// with the request ID and route name added as fields.
+// DefaultAccessReporter and ExtendedAccessReporter are factories.
+type AccessReporterFactory func(ctx requestcontext.Ctx, logger Logger) AccessReporter
+
+// DefaultAccessReporter logs every request with the method, uri, status,
+// size and duration_ms fields.
+func DefaultAccessReporter(ctx requestcontext.Ctx, logger Logger) AccessReporter {
 	return func(entry *AccessEntry) {
-		milliseconds := int(entry.duration / time.Millisecond)
-		logger.Info(ctx, "%s %s %d %d %d", entry.requestMethod, entry.requestURI, entry.statusCode, entry.size, milliseconds)
+		logger.Info("request", accessLogFields(entry)...)
+		reportDebug(logger, entry)
 	}
 }
 
 // ExtendedAccessReporter createsan access logger that logs everything that DefaultAccessReporter does with the User-Agent added to that
-func ExtendedAccessReporter(ctx requestcontext.Ctx, logger requestcontext.Logger) AccessReporter {
+func ExtendedAccessReporter(ctx requestcontext.Ctx, logger Logger) AccessReporter {
 	return func(entry *AccessEntry) {
-		milliseconds := int(entry.duration / time.Millisecond)
-		logger.Info(ctx, "%s %s %d %d %d %s", entry.requestMethod, entry.requestURI, entry.statusCode, entry.size, milliseconds, entry.Request().Header.Get("User-Agent"))
+		fields := append(accessLogFields(entry), "user_agent", entry.Request().Header.Get("User-Agent"))
+		logger.Info("request", fields...)
+		reportDebug(logger, entry)
+	}
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type accessEntryKey struct{}
+
+func accessLogFields(entry *AccessEntry) []interface{} {
+	return []interface{}{
+		"method", entry.requestMethod,
+		"uri", entry.requestURI,
+		"status", entry.statusCode,
+		"size", entry.size,
+		"duration_ms", int64(entry.duration / time.Millisecond),
+	}
+}
+
+// accessEntryFromRequest returns the entry of a request handled by
+// NewLogAccessHandler, or nil.
+func accessEntryFromRequest(req *http.Request) *AccessEntry {
+	entry, _ := req.Context().Value(accessEntryKey{}).(*AccessEntry)
+	return entry
+}
+
+func (ae *AccessEntry) setPrincipal(principal string) {
+	ae.mutex.Lock()
+	defer ae.mutex.Unlock()
+
+	ae.principal = principal
+}
+
+func (ae *AccessEntry) annotate(key, value string) {
+	ae.mutex.Lock()
+	defer ae.mutex.Unlock()
+
+	if ae.annotations == nil {
+		ae.annotations = map[string]string{}
+	}
+	ae.annotations[key] = value
+}
+
+// countingReadCloser counts the bytes read from the request body.
+type countingReadCloser struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return "unknown"
 	}
 }
+
+// reportDebug logs the captured headers and bodies, if any.
+func reportDebug(logger Logger, entry *AccessEntry) {
+	capture := entry.Debug()
+	if capture == nil {
+		return
+	}
+
+	logger.Info("debug capture", "method", entry.requestMethod, "uri", entry.requestURI, "debug", capture)
+}
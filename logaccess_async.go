@@ -0,0 +1,95 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/giantswarm/request-context"
+)
+
+// AsyncAccessReporter runs the reporters of a factory in the background, so
+// slow sinks don't add latency to requests. Entries are buffered up to the
+// configured size, further entries are dropped and counted.
+type AsyncAccessReporter struct {
+	factory  AccessReporterFactory
+	queue    chan func()
+	done     chan struct{}
+	dropped  uint64
+	reported uint64
+
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewAsyncAccessReporter creates an AsyncAccessReporter buffering up to
+// bufferSize entries and starts reporting in the background. Register it
+// using `srv.AddAccessReporter(async.Reporter)`.
+func NewAsyncAccessReporter(factory AccessReporterFactory, bufferSize int) *AsyncAccessReporter {
+	a := &AsyncAccessReporter{
+		factory: factory,
+		queue:   make(chan func(), bufferSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+
+	return a
+}
+
+// Reporter is an AccessReporterFactory queueing the entries for the reporter
+// created by the wrapped factory.
+func (a *AsyncAccessReporter) Reporter(ctx requestcontext.Ctx, logger Logger) AccessReporter {
+	reporter := a.factory(ctx, logger)
+
+	return func(entry *AccessEntry) {
+		a.mutex.RLock()
+		defer a.mutex.RUnlock()
+
+		if a.closed {
+			atomic.AddUint64(&a.dropped, 1)
+			return
+		}
+
+		select {
+		case a.queue <- func() { reporter(entry) }:
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of entries dropped because the buffer was full.
+func (a *AsyncAccessReporter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Reported returns the number of entries reported.
+func (a *AsyncAccessReporter) Reported() uint64 {
+	return atomic.LoadUint64(&a.reported)
+}
+
+// Close reports the buffered entries and stops the reporter. Entries queued
+// afterwards are dropped.
+func (a *AsyncAccessReporter) Close() {
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.queue)
+	a.mutex.Unlock()
+
+	<-a.done
+}
+
+//------------------------------------------------------------------------------
+// private
+
+func (a *AsyncAccessReporter) run() {
+	defer close(a.done)
+
+	for report := range a.queue {
+		report()
+		atomic.AddUint64(&a.reported, 1)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/request-context"
+)
+
+// JSONAccessOptions configures the JSONAccessReporter.
+type JSONAccessOptions struct {
+	// Writer receives one JSON object per line and request, e.g. a dedicated
+	// access log file. If nil, the objects are logged using the logger of the
+	// server.
+	Writer io.Writer
+
+	// Headers are the names of request headers added to every entry.
+	Headers []string
+}
+
+// JSONAccessRecord is the object emitted by the JSONAccessReporter.
+type JSONAccessRecord struct {
+	Time            time.Time         `json:"time"`
+	Method          string            `json:"method"`
+	URI             string            `json:"uri"`
+	Protocol        string            `json:"protocol"`
+	Route           string            `json:"route"`
+	Status          int               `json:"status"`
+	Size            int64             `json:"size"`
+	RequestSize     int64             `json:"request_size"`
+	Duration        float64           `json:"duration_ms"`
+	TimeToFirstByte float64           `json:"ttfb_ms"`
+	RequestID       string            `json:"request_id,omitempty"`
+	RemoteAddr      string            `json:"remote_addr"`
+	ClientIP        string            `json:"client_ip,omitempty"`
+	TLSVersion      string            `json:"tls_version,omitempty"`
+	TLSCipherSuite  string            `json:"tls_cipher_suite,omitempty"`
+	Principal       string            `json:"principal,omitempty"`
+	UserAgent       string            `json:"user_agent,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	Debug           *DebugCapture     `json:"debug,omitempty"`
+}
+
+// JSONAccessReporter creates an access logger that emits one JSON object per
+// request, so log pipelines don't need to parse printf style lines.
+func JSONAccessReporter(options JSONAccessOptions) AccessReporterFactory {
+	var mutex sync.Mutex
+
+	return func(ctx requestcontext.Ctx, logger Logger) AccessReporter {
+		return func(entry *AccessEntry) {
+			raw, err := json.Marshal(newJSONAccessRecord(ctx, entry, options.Headers))
+			if err != nil {
+				logger.Error("marshaling access record failed", "error", err)
+				return
+			}
+
+			if options.Writer == nil {
+				logger.Info(string(raw))
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if _, err := options.Writer.Write(append(raw, '\n')); err != nil {
+				logger.Error("writing access record failed", "error", err)
+			}
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+// private
+
+func newJSONAccessRecord(ctx requestcontext.Ctx, entry *AccessEntry, headers []string) JSONAccessRecord {
+	record := JSONAccessRecord{
+		Time:            entry.start,
+		Method:          entry.requestMethod,
+		URI:             entry.requestURI,
+		Protocol:        entry.Protocol(),
+		Route:           entry.routeName,
+		Status:          entry.statusCode,
+		Size:            entry.size,
+		RequestSize:     entry.requestSize,
+		Duration:        float64(entry.duration) / float64(time.Millisecond),
+		TimeToFirstByte: float64(entry.timeToFirstByte) / float64(time.Millisecond),
+		RemoteAddr:      entry.request.RemoteAddr,
+		TLSVersion:      entry.TLSVersion(),
+		TLSCipherSuite:  entry.TLSCipherSuite(),
+		Principal:       entry.Principal(),
+		UserAgent:       entry.request.Header.Get("User-Agent"),
+		Debug:           entry.Debug(),
+	}
+	record.RequestID, _ = ctx[RequestIDKey].(string)
+	if entry.clientIP != nil {
+		record.ClientIP = entry.clientIP.String()
+	}
+	if annotations := entry.Annotations(); len(annotations) > 0 {
+		record.Annotations = annotations
+	}
+
+	for _, name := range headers {
+		if value := entry.request.Header.Get(name); value != "" {
+			if record.Headers == nil {
+				record.Headers = map[string]string{}
+			}
+			record.Headers[name] = value
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"math/rand"
+	"time"
+)
+
+// AccessLogPolicy decides which requests are reported by the access
+// reporter set using `Server.SetAccessReporter`. Reporters added using
+// `Server.AddAccessReporter`, metrics and traces are not affected.
+type AccessLogPolicy struct {
+	// SampleRates maps route names, e.g. "GET /healthcheck", to the fraction
+	// of requests reported, e.g. 0.01 to report every 100th request. Routes
+	// not listed are always reported.
+	SampleRates map[string]float64
+
+	// Suppress contains route names that are never reported.
+	Suppress []string
+
+	// AlwaysLogErrors reports every request answered with a 4xx or 5xx status
+	// code, regardless of its sample rate.
+	AlwaysLogErrors bool
+
+	// SlowThreshold enables logging a warning with details about every request
+	// taking longer, unless its route is suppressed. Zero disables it.
+	SlowThreshold time.Duration
+}
+
+// SetAccessLogPolicy sets the policy deciding which requests are reported by
+// the access reporter, e.g. to sample high traffic routes.
+func (s *Server) SetAccessLogPolicy(policy AccessLogPolicy) {
+	s.accessLogPolicy = newAccessLogPolicy(policy)
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type accessLogPolicy struct {
+	AccessLogPolicy
+	suppress map[string]bool
+}
+
+func newAccessLogPolicy(policy AccessLogPolicy) *accessLogPolicy {
+	p := &accessLogPolicy{
+		AccessLogPolicy: policy,
+		suppress:        map[string]bool{},
+	}
+	for _, route := range policy.Suppress {
+		p.suppress[route] = true
+	}
+
+	return p
+}
+
+// wrap applies the policy to the given reporter.
+func (p *accessLogPolicy) wrap(reporter AccessReporter, logger Logger) AccessReporter {
+	return func(entry *AccessEntry) {
+		if p.suppress[entry.routeName] {
+			return
+		}
+
+		if p.SlowThreshold > 0 && entry.duration > p.SlowThreshold {
+			logger.Warn("slow request",
+				"method", entry.requestMethod,
+				"uri", entry.requestURI,
+				"duration", entry.duration.String(),
+				"threshold", p.SlowThreshold.String(),
+				"status", entry.statusCode,
+				"size", entry.size,
+				"route", entry.routeName,
+				"client_ip", entry.clientIP.String(),
+				"user_agent", entry.request.Header.Get("User-Agent"))
+		}
+
+		if p.sampled(entry) {
+			reporter(entry)
+		}
+	}
+}
+
+func (p *accessLogPolicy) sampled(entry *AccessEntry) bool {
+	if p.AlwaysLogErrors && entry.statusCode >= 400 {
+		return true
+	}
+
+	rate, ok := p.SampleRates[entry.routeName]
+	if !ok || rate >= 1 {
+		return true
+	}
+
+	return rand.Float64() < rate
+}
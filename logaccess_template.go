@@ -0,0 +1,297 @@
+package server
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/request-context"
+	"github.com/juju/errgo"
+)
+
+const (
+	// CommonLogFormat is the Apache Common Log Format (CLF).
+	CommonLogFormat = `%h %l %u %t "%r" %>s %b`
+
+	// CombinedLogFormat is the Apache Combined Log Format.
+	CombinedLogFormat = `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`
+
+	clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// CommonAccessReporter creates an access logger using the CommonLogFormat,
+// see TemplateAccessReporter.
+func CommonAccessReporter(w io.Writer) AccessReporterFactory {
+	return mustTemplateAccessReporter(CommonLogFormat, w)
+}
+
+// CombinedAccessReporter creates an access logger using the
+// CombinedLogFormat, see TemplateAccessReporter.
+func CombinedAccessReporter(w io.Writer) AccessReporterFactory {
+	return mustTemplateAccessReporter(CombinedLogFormat, w)
+}
+
+// TemplateAccessReporter creates an access logger writing one line per
+// request to w, formatted according to the given template. If w is nil, the
+// lines are logged using the logger of the server. The template supports the
+// following directives known from Apache:
+//
+//	%h         IP address of the peer, e.g. a proxy
+//	%a         IP address of the client, see Server.SetTrustedProxies
+//	%l         remote logname, always "-"
+//	%u         principal set using Context.SetPrincipal
+//	%t         time the request was received, e.g. [10/Oct/2000:13:55:36 -0700]
+//	%r         first line of the request, e.g. GET /index.html HTTP/1.1
+//	%s, %>s    status code
+//	%b         response size in bytes, "-" if no bytes were sent
+//	%B         response size in bytes
+//	%I         request body size in bytes
+//	%D         duration in microseconds
+//	%T         duration in seconds
+//	%m         request method
+//	%U         URL path
+//	%q         query string prefixed with "?", or an empty string
+//	%H         request protocol
+//	%R         route name
+//	%{Name}i   request header
+//	%{Name}n   annotation added using Context.Annotate
+//	%%         a literal "%"
+//
+// Additionally, `{Name}` is replaced by the request header Name. As a special
+// case, `{X-Request-ID}` is replaced by the ID of the request, which includes
+// the ID given by the client, if any.
+func TemplateAccessReporter(format string, w io.Writer) (AccessReporterFactory, error) {
+	directives, err := parseAccessTemplate(format)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	var mutex sync.Mutex
+
+	return func(ctx requestcontext.Ctx, logger Logger) AccessReporter {
+		return func(entry *AccessEntry) {
+			var line strings.Builder
+			for _, d := range directives {
+				d(&line, ctx, entry)
+			}
+
+			if w == nil {
+				logger.Info(line.String())
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if _, err := io.WriteString(w, line.String()+"\n"); err != nil {
+				logger.Error("writing access log failed", "error", err)
+			}
+		}
+	}, nil
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type accessDirective func(line *strings.Builder, ctx requestcontext.Ctx, entry *AccessEntry)
+
+func mustTemplateAccessReporter(format string, w io.Writer) AccessReporterFactory {
+	factory, err := TemplateAccessReporter(format, w)
+	if err != nil {
+		panic(err)
+	}
+
+	return factory
+}
+
+func parseAccessTemplate(format string) ([]accessDirective, error) {
+	var directives []accessDirective
+	literal := func(s string) {
+		directives = append(directives, func(line *strings.Builder, ctx requestcontext.Ctx, entry *AccessEntry) {
+			line.WriteString(s)
+		})
+	}
+	value := func(fn func(ctx requestcontext.Ctx, entry *AccessEntry) string) {
+		directives = append(directives, func(line *strings.Builder, ctx requestcontext.Ctx, entry *AccessEntry) {
+			v := fn(ctx, entry)
+			if v == "" {
+				v = "-"
+			}
+			line.WriteString(escapeLogValue(v))
+		})
+	}
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+
+		if c == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return nil, errgo.Newf("unterminated '{' at position %d", i)
+			}
+			value(accessHeaderValue(format[i+1 : i+end]))
+			i += end
+			continue
+		}
+
+		if c != '%' {
+			start := i
+			for i+1 < len(format) && format[i+1] != '%' && format[i+1] != '{' {
+				i++
+			}
+			literal(format[start : i+1])
+			continue
+		}
+
+		i++
+		if i >= len(format) {
+			return nil, errgo.New("incomplete directive at end of format")
+		}
+
+		switch format[i] {
+		case '%':
+			literal("%")
+		case 'h':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				host, _, err := net.SplitHostPort(entry.request.RemoteAddr)
+				if err != nil {
+					return entry.request.RemoteAddr
+				}
+				return host
+			})
+		case 'a':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				if entry.clientIP == nil {
+					return ""
+				}
+				return entry.clientIP.String()
+			})
+		case 'l':
+			literal("-")
+		case 'u':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return entry.Principal()
+			})
+		case 't':
+			directives = append(directives, func(line *strings.Builder, ctx requestcontext.Ctx, entry *AccessEntry) {
+				line.WriteString("[" + entry.start.Format(clfTimeFormat) + "]")
+			})
+		case 'r':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return entry.requestMethod + " " + entry.requestURI + " " + entry.request.Proto
+			})
+		case '>':
+			if i+1 >= len(format) || format[i+1] != 's' {
+				return nil, errgo.Newf("unknown directive '%%>' at position %d", i-1)
+			}
+			i++
+			fallthrough
+		case 's':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return strconv.Itoa(entry.statusCode)
+			})
+		case 'b':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				if entry.size == 0 {
+					return ""
+				}
+				return strconv.FormatInt(entry.size, 10)
+			})
+		case 'B':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return strconv.FormatInt(entry.size, 10)
+			})
+		case 'I':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return strconv.FormatInt(entry.requestSize, 10)
+			})
+		case 'D':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return strconv.FormatInt(int64(entry.duration/time.Microsecond), 10)
+			})
+		case 'T':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return strconv.FormatInt(int64(entry.duration/time.Second), 10)
+			})
+		case 'm':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return entry.requestMethod
+			})
+		case 'U':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return entry.request.URL.Path
+			})
+		case 'q':
+			directives = append(directives, func(line *strings.Builder, ctx requestcontext.Ctx, entry *AccessEntry) {
+				if q := entry.request.URL.RawQuery; q != "" {
+					line.WriteString(escapeLogValue("?" + q))
+				}
+			})
+		case 'H':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return entry.request.Proto
+			})
+		case 'R':
+			value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+				return entry.routeName
+			})
+		case '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 || i+end+1 >= len(format) {
+				return nil, errgo.Newf("unterminated '%%{' at position %d", i-1)
+			}
+			name := format[i+1 : i+end]
+			switch format[i+end+1] {
+			case 'i':
+				value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+					return entry.request.Header.Get(name)
+				})
+			case 'n':
+				value(func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+					return entry.Annotations()[name]
+				})
+			default:
+				return nil, errgo.Newf("unknown directive '%%{%s}%c' at position %d", name, format[i+end+1], i-1)
+			}
+			i += end + 1
+		default:
+			return nil, errgo.Newf("unknown directive '%%%c' at position %d", format[i], i-1)
+		}
+	}
+
+	return directives, nil
+}
+
+func accessHeaderValue(name string) func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+	if strings.EqualFold(name, RequestIDHeader) {
+		return func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+			id, _ := ctx[RequestIDKey].(string)
+			return id
+		}
+	}
+
+	return func(ctx requestcontext.Ctx, entry *AccessEntry) string {
+		return entry.request.Header.Get(name)
+	}
+}
+
+// escapeLogValue escapes quotes, backslashes and non-printable characters,
+// so that client controlled values can't break the log format.
+func escapeLogValue(s string) string {
+	needsEscaping := false
+	for _, r := range s {
+		if r == '"' || r == '\\' || !strconv.IsPrint(r) {
+			needsEscaping = true
+			break
+		}
+	}
+	if !needsEscaping {
+		return s
+	}
+
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
@@ -0,0 +1,446 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/giantswarm/request-context"
+
+	srvPkg "github.com/giantswarm/middleware-server"
+)
+
+var _ = Describe("access logging", func() {
+	var (
+		srv *srvPkg.Server
+		out *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+
+		srv = srvPkg.NewServer("", "")
+		srv.Serve("GET", "/hello", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+			return ctx.Response.PlainText("hello world", http.StatusOK)
+		})
+		srv.Serve("POST", "/login", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+			var body map[string]interface{}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return err
+			}
+			res.Header().Set("Set-Cookie", "session=secret")
+			return ctx.Response.Json(map[string]string{"user": body["user"].(string), "token": "secret"}, http.StatusOK)
+		})
+	})
+
+	Describe("JSON access reporter", func() {
+		var record srvPkg.JSONAccessRecord
+
+		BeforeEach(func() {
+			srv.SetAccessReporter(srvPkg.JSONAccessReporter(srvPkg.JSONAccessOptions{
+				Writer:  out,
+				Headers: []string{"X-Forwarded-For", "X-Missing"},
+			}))
+
+			req := httptest.NewRequest("GET", "/hello?foo=bar", nil)
+			req.Header.Set("User-Agent", "test-agent")
+			req.Header.Set("X-Request-ID", "test-id")
+			req.Header.Set("X-Forwarded-For", "10.0.0.1")
+			serve(srv, req)
+
+			Expect(json.Unmarshal(out.Bytes(), &record)).To(BeNil())
+		})
+
+		It("should write exactly one line", func() {
+			Expect(bytes.Count(out.Bytes(), []byte("\n"))).To(Equal(1))
+		})
+
+		It("should contain the request details", func() {
+			Expect(record.Method).To(Equal("GET"))
+			Expect(record.URI).To(Equal("/hello?foo=bar"))
+			Expect(record.Route).To(Equal("GET /hello"))
+			Expect(record.RemoteAddr).To(Equal("192.0.2.1:1234"))
+			Expect(record.UserAgent).To(Equal("test-agent"))
+			Expect(record.RequestID).To(HavePrefix("test-id, "))
+			Expect(record.Time.IsZero()).To(BeFalse())
+		})
+
+		It("should contain the response details", func() {
+			Expect(record.Status).To(Equal(http.StatusOK))
+			Expect(record.Size).To(Equal(int64(11)))
+		})
+
+		It("should contain the configured headers", func() {
+			Expect(record.Headers).To(Equal(map[string]string{"X-Forwarded-For": "10.0.0.1"}))
+		})
+	})
+
+	Describe("template access reporters", func() {
+		var req *http.Request
+
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "/hello?foo=bar", nil)
+			req.Header.Set("User-Agent", "test-agent")
+			req.Header.Set("X-Request-ID", "test-id")
+		})
+
+		It("should write the combined log format", func() {
+			srv.SetAccessReporter(srvPkg.CombinedAccessReporter(out))
+			serve(srv, req)
+
+			Expect(out.String()).To(MatchRegexp(`^192\.0\.2\.1 - - \[[^\]]+\] "GET /hello\?foo=bar HTTP/1\.1" 200 11 "-" "test-agent"\n$`))
+		})
+
+		It("should write custom templates", func() {
+			Expect(srv.SetAccessLogFormat(`%m %U%q %>s %B %D {X-Request-ID} %{User-Agent}i %R %%`, out)).To(BeNil())
+			serve(srv, req)
+
+			Expect(out.String()).To(MatchRegexp(`^GET /hello\?foo=bar 200 11 \d+ test-id, [a-z0-9]{16} test-agent GET /hello %\n$`))
+		})
+
+		It("should escape quotes given by clients", func() {
+			req.Header.Set("User-Agent", `evil" agent`)
+			srv.SetAccessReporter(srvPkg.CombinedAccessReporter(out))
+			serve(srv, req)
+
+			Expect(out.String()).To(ContainSubstring(`"evil\" agent"`))
+		})
+
+		It("should reject unknown directives", func() {
+			Expect(srv.SetAccessLogFormat(`%Z`, out)).NotTo(BeNil())
+		})
+	})
+
+	Describe("debug logging", func() {
+		var (
+			record srvPkg.JSONAccessRecord
+			req    *http.Request
+		)
+
+		BeforeEach(func() {
+			record = srvPkg.JSONAccessRecord{}
+			srv.SetAccessReporter(srvPkg.JSONAccessReporter(srvPkg.JSONAccessOptions{Writer: out}))
+
+			req = httptest.NewRequest("POST", "/login", strings.NewReader(`{"user":"alice","password":"secret"}`))
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("Content-Type", "application/json")
+		})
+
+		JustBeforeEach(func() {
+			serve(srv, req)
+			Expect(json.Unmarshal(out.Bytes(), &record)).To(BeNil())
+		})
+
+		Context("debug logging disabled", func() {
+			BeforeEach(func() {
+				req.Header.Set("X-Debug", "1")
+			})
+
+			It("should not capture anything", func() {
+				Expect(record.Debug).To(BeNil())
+			})
+		})
+
+		Context("debug logging enabled for the route", func() {
+			BeforeEach(func() {
+				Expect(srv.SetDebugLogging(srvPkg.DebugLogOptions{
+					Routes:           []string{"POST /login"},
+					RedactJSONFields: []string{"password", "token"},
+				})).To(BeNil())
+			})
+
+			It("should capture the request", func() {
+				Expect(record.Debug).NotTo(BeNil())
+				Expect(record.Debug.RequestBody).To(MatchJSON(`{"user":"alice","password":"[REDACTED]"}`))
+				Expect(record.Debug.RequestHeader.Get("Authorization")).To(Equal("[REDACTED]"))
+				Expect(record.Debug.RequestHeader.Get("Content-Type")).To(Equal("application/json"))
+			})
+
+			It("should capture the response", func() {
+				Expect(record.Debug.ResponseBody).To(MatchJSON(`{"user":"alice","token":"[REDACTED]"}`))
+				Expect(record.Debug.ResponseHeader.Get("Set-Cookie")).To(Equal("[REDACTED]"))
+			})
+		})
+
+		Context("debug logging enabled by a trusted client", func() {
+			BeforeEach(func() {
+				Expect(srv.SetDebugLogging(srvPkg.DebugLogOptions{
+					TrustedClients: []string{"192.0.2.0/24"},
+					MaxBodySize:    10,
+				})).To(BeNil())
+				req.Header.Set("X-Debug", "1")
+			})
+
+			It("should capture the truncated bodies", func() {
+				Expect(record.Debug).NotTo(BeNil())
+				Expect(record.Debug.RequestBody).To(Equal(`{"user":"a`))
+				Expect(record.Debug.RequestBodyTruncated).To(BeTrue())
+			})
+		})
+
+		Context("debug logging requested by an untrusted client", func() {
+			BeforeEach(func() {
+				Expect(srv.SetDebugLogging(srvPkg.DebugLogOptions{
+					TrustedClients: []string{"10.0.0.0/8"},
+				})).To(BeNil())
+				req.Header.Set("X-Debug", "1")
+			})
+
+			It("should not capture anything", func() {
+				Expect(record.Debug).To(BeNil())
+			})
+		})
+	})
+
+	Describe("access log policy", func() {
+		BeforeEach(func() {
+			srv.Serve("GET", "/fail", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				return ctx.Response.Error("failed", http.StatusBadRequest)
+			})
+			srv.SetAccessReporter(srvPkg.CombinedAccessReporter(out))
+		})
+
+		It("should not report requests of routes never sampled", func() {
+			srv.SetAccessLogPolicy(srvPkg.AccessLogPolicy{
+				SampleRates: map[string]float64{"GET /hello": 0},
+			})
+			serve(srv, httptest.NewRequest("GET", "/hello", nil))
+
+			Expect(out.Len()).To(Equal(0))
+		})
+
+		It("should report errors of routes never sampled", func() {
+			srv.SetAccessLogPolicy(srvPkg.AccessLogPolicy{
+				SampleRates:     map[string]float64{"GET /fail": 0},
+				AlwaysLogErrors: true,
+			})
+			serve(srv, httptest.NewRequest("GET", "/fail", nil))
+
+			Expect(out.String()).To(ContainSubstring(`"GET /fail HTTP/1.1" 400`))
+		})
+
+		It("should not report suppressed routes at all", func() {
+			srv.SetAccessLogPolicy(srvPkg.AccessLogPolicy{
+				Suppress:        []string{"GET /fail"},
+				AlwaysLogErrors: true,
+			})
+			serve(srv, httptest.NewRequest("GET", "/fail", nil))
+
+			Expect(out.Len()).To(Equal(0))
+		})
+
+		It("should report routes without sample rate", func() {
+			srv.SetAccessLogPolicy(srvPkg.AccessLogPolicy{
+				SampleRates: map[string]float64{"GET /fail": 0},
+			})
+			serve(srv, httptest.NewRequest("GET", "/hello", nil))
+
+			Expect(out.String()).To(ContainSubstring(`"GET /hello HTTP/1.1" 200`))
+		})
+
+		Describe("slow requests", func() {
+			var logger *srvPkg.RecordingLogger
+
+			BeforeEach(func() {
+				logger = srvPkg.NewRecordingLogger()
+				srv.SetLogger(logger)
+				srv.Serve("GET", "/slow", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+					time.Sleep(20 * time.Millisecond)
+					return ctx.Response.PlainText("done", http.StatusOK)
+				})
+			})
+
+			slowRecords := func() []srvPkg.LogRecord {
+				var records []srvPkg.LogRecord
+				for _, record := range logger.Records() {
+					if record.Message == "slow request" {
+						records = append(records, record)
+					}
+				}
+				return records
+			}
+
+			It("should warn about requests taking longer than the threshold", func() {
+				srv.SetAccessLogPolicy(srvPkg.AccessLogPolicy{SlowThreshold: 10 * time.Millisecond})
+				serve(srv, httptest.NewRequest("GET", "/slow", nil))
+
+				records := slowRecords()
+				Expect(records).To(HaveLen(1))
+				Expect(records[0].Level).To(Equal("WARNING"))
+				Expect(records[0].Fields).To(HaveKey("duration"))
+				Expect(records[0].Fields).To(HaveKeyWithValue("threshold", "10ms"))
+				Expect(records[0].Fields).To(HaveKeyWithValue("uri", "/slow"))
+				Expect(records[0].Fields).To(HaveKeyWithValue("client_ip", "192.0.2.1"))
+			})
+
+			It("should not warn about requests faster than the threshold", func() {
+				srv.SetAccessLogPolicy(srvPkg.AccessLogPolicy{SlowThreshold: time.Second})
+				serve(srv, httptest.NewRequest("GET", "/slow", nil))
+
+				Expect(slowRecords()).To(BeEmpty())
+			})
+
+			It("should warn about slow requests of routes not sampled", func() {
+				srv.SetAccessLogPolicy(srvPkg.AccessLogPolicy{
+					SampleRates:   map[string]float64{"GET /slow": 0},
+					SlowThreshold: 10 * time.Millisecond,
+				})
+				serve(srv, httptest.NewRequest("GET", "/slow", nil))
+
+				Expect(slowRecords()).To(HaveLen(1))
+				Expect(out.Len()).To(Equal(0))
+			})
+
+			It("should not warn about slow requests of suppressed routes", func() {
+				srv.SetAccessLogPolicy(srvPkg.AccessLogPolicy{
+					Suppress:      []string{"GET /slow"},
+					SlowThreshold: 10 * time.Millisecond,
+				})
+				serve(srv, httptest.NewRequest("GET", "/slow", nil))
+
+				Expect(slowRecords()).To(BeEmpty())
+				Expect(out.Len()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("multiple access reporters", func() {
+		var reported []string
+
+		recorder := func(name string) srvPkg.AccessReporterFactory {
+			return func(ctx requestcontext.Ctx, logger srvPkg.Logger) srvPkg.AccessReporter {
+				return func(entry *srvPkg.AccessEntry) {
+					reported = append(reported, name+" "+entry.RouteName())
+				}
+			}
+		}
+
+		BeforeEach(func() {
+			reported = nil
+			srv.SetAccessReporter(recorder("log"))
+			srv.AddAccessReporter(recorder("audit"))
+			srv.AddAccessReporter(recorder("analytics"))
+		})
+
+		It("should run all reporters in order", func() {
+			serve(srv, httptest.NewRequest("GET", "/hello", nil))
+
+			Expect(reported).To(Equal([]string{"log GET /hello", "audit GET /hello", "analytics GET /hello"}))
+		})
+
+		It("should run added reporters if access logging is disabled", func() {
+			srv.SetAccessReporter(nil)
+			serve(srv, httptest.NewRequest("GET", "/hello", nil))
+
+			Expect(reported).To(Equal([]string{"audit GET /hello", "analytics GET /hello"}))
+		})
+
+		It("should not apply the access log policy to added reporters", func() {
+			srv.SetAccessLogPolicy(srvPkg.AccessLogPolicy{Suppress: []string{"GET /hello"}})
+			serve(srv, httptest.NewRequest("GET", "/hello", nil))
+
+			Expect(reported).To(Equal([]string{"audit GET /hello", "analytics GET /hello"}))
+		})
+	})
+
+	Describe("async access reporter", func() {
+		var (
+			release chan struct{}
+			async   *srvPkg.AsyncAccessReporter
+		)
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			slow := func(ctx requestcontext.Ctx, logger srvPkg.Logger) srvPkg.AccessReporter {
+				return func(entry *srvPkg.AccessEntry) {
+					<-release
+				}
+			}
+			async = srvPkg.NewAsyncAccessReporter(slow, 1)
+			srv.SetAccessReporter(nil)
+			srv.AddAccessReporter(async.Reporter)
+		})
+
+		It("should not delay requests and drop entries if the buffer is full", func() {
+			for i := 0; i < 5; i++ {
+				res := serve(srv, httptest.NewRequest("GET", "/hello", nil))
+				Expect(res.Code).To(Equal(http.StatusOK))
+			}
+
+			// One entry is being reported, one is buffered, the rest is dropped.
+			Expect(async.Dropped()).To(BeNumerically(">=", 3))
+
+			close(release)
+			async.Close()
+			Expect(async.Reported() + async.Dropped()).To(Equal(uint64(5)))
+		})
+
+		It("should drop entries after being closed", func() {
+			close(release)
+			async.Close()
+			serve(srv, httptest.NewRequest("GET", "/hello", nil))
+
+			Expect(async.Reported()).To(Equal(uint64(0)))
+			Expect(async.Dropped()).To(Equal(uint64(1)))
+		})
+	})
+
+	Describe("access entry details", func() {
+		var record srvPkg.JSONAccessRecord
+
+		BeforeEach(func() {
+			record = srvPkg.JSONAccessRecord{}
+			srv.Serve("POST", "/upload", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				ioutil.ReadAll(req.Body)
+				ctx.SetPrincipal("alice")
+				ctx.Annotate("tenant", "acme")
+				return ctx.Response.NoContent()
+			})
+			srv.SetAccessReporter(srvPkg.JSONAccessReporter(srvPkg.JSONAccessOptions{Writer: out}))
+		})
+
+		JustBeforeEach(func() {
+			req := httptest.NewRequest("POST", "/upload", strings.NewReader("hello world"))
+			req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.2")
+			serve(srv, req)
+			Expect(json.Unmarshal(out.Bytes(), &record)).To(BeNil())
+		})
+
+		It("should contain the details set by middlewares", func() {
+			Expect(record.Principal).To(Equal("alice"))
+			Expect(record.Annotations).To(Equal(map[string]string{"tenant": "acme"}))
+		})
+
+		It("should contain the request details", func() {
+			Expect(record.RequestSize).To(Equal(int64(11)))
+			Expect(record.Protocol).To(Equal("HTTP/1.1"))
+			Expect(record.TimeToFirstByte).To(BeNumerically("<=", record.Duration))
+			Expect(record.TLSVersion).To(BeEmpty())
+		})
+
+		Context("without trusted proxies", func() {
+			It("should ignore forwarding headers", func() {
+				Expect(record.ClientIP).To(Equal("192.0.2.1"))
+			})
+		})
+
+		Context("with trusted proxies", func() {
+			BeforeEach(func() {
+				tp, err := srvPkg.NewTrustedProxies("192.0.2.0/24", "10.0.0.0/8")
+				Expect(err).To(BeNil())
+				srv.SetTrustedProxies(tp)
+			})
+
+			It("should resolve the client IP", func() {
+				Expect(record.ClientIP).To(Equal("203.0.113.7"))
+			})
+		})
+	})
+})
@@ -1,40 +1,110 @@
 package server
 
 import (
-	"os"
+	"encoding/json"
+	"fmt"
+	"strings"
 
+	"github.com/giantswarm/request-context"
 	"github.com/juju/errgo"
+)
 
-	Stdlog "log"
+// Logger is a leveled logger with structured key/value fields, e.g.
+// `logger.Info("user created", "user", name)`. Use NewGoLoggingLogger,
+// NewSlogLogger or NewRecordingLogger, or implement it for any other logging
+// library.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
 
-	log "github.com/op/go-logging"
-)
+	// With returns a logger adding the given key/value pairs to every
+	// message.
+	With(keyvals ...interface{}) Logger
+}
+
+// Leveler is implemented by loggers whose level can be changed at runtime,
+// see `Server.ChangeLogLevel`. Levels are "DEBUG", "INFO", "NOTICE",
+// "WARNING", "ERROR" and "CRITICAL".
+type Leveler interface {
+	Level() string
+	SetLevel(level string) error
+}
 
 type LoggerOptions struct {
 	Name  string
 	Level string
 }
 
-// NewSimpleLogger creates a new logger with a default backend logging to `os.Stderr`.
-func NewLogger(options LoggerOptions) *log.Logger {
-	// Create new logger.
-	logger := log.MustGetLogger(options.Name)
+// NewLogger creates a new go-logging based logger logging to `os.Stderr`.
+func NewLogger(options LoggerOptions) Logger {
+	return NewGoLoggingLogger(requestcontext.LoggerConfig{
+		Name:  options.Name,
+		Level: options.Level,
+		Color: true,
+	})
+}
+
+//------------------------------------------------------------------------------
+// private
 
-	// Configure logger.
-	log.SetFormatter(log.MustStringFormatter("[%{level}] %{message}"))
-	logBackend := log.NewLogBackend(os.Stderr, "", Stdlog.LstdFlags|Stdlog.Lshortfile)
-	logBackend.Color = true
-	log.SetBackend(logBackend)
+// logLevelRanks orders the levels by severity.
+var logLevelRanks = map[string]int{
+	"DEBUG":    0,
+	"INFO":     1,
+	"NOTICE":   2,
+	"WARNING":  3,
+	"ERROR":    4,
+	"CRITICAL": 5,
+}
 
-	// Set log level.
-	if options.Level != "" {
-		logLevel, err := log.LogLevel(options.Level)
-		if err != nil {
-			panic(errgo.Mask(err))
+// parseLogLevel normalizes the given level, e.g. "warn" becomes "WARNING".
+func parseLogLevel(level string) (string, error) {
+	level = strings.ToUpper(level)
+	if level == "WARN" {
+		level = "WARNING"
+	}
+	if _, ok := logLevelRanks[level]; !ok {
+		return "", errgo.Newf("invalid log level '%s'", level)
+	}
+
+	return level, nil
+}
+
+// logFields merges the given key/value pairs into a map. A key without value
+// is kept as "!BADKEY", like log/slog does. Errors are added as their
+// message, as most of them cannot be marshaled.
+func logFields(keyvals ...[]interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for _, kvs := range keyvals {
+		for i := 0; i < len(kvs); i += 2 {
+			if i+1 == len(kvs) {
+				fields["!BADKEY"] = kvs[i]
+				break
+			}
+
+			value := kvs[i+1]
+			if err, ok := value.(error); ok {
+				value = err.Error()
+			}
+			fields[fmt.Sprint(kvs[i])] = value
 		}
+	}
+
+	return fields
+}
+
+// formatLogFields appends the fields as JSON object to the message.
+func formatLogFields(msg string, fields map[string]interface{}) string {
+	if len(fields) == 0 {
+		return msg
+	}
 
-		log.SetLevel(logLevel, options.Name)
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Sprintf("%s | %v", msg, fields)
 	}
 
-	return logger
+	return msg + " | " + string(raw)
 }
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/giantswarm/request-context"
+	"github.com/juju/errgo"
+)
+
+// NewGoLoggingLogger creates a Logger based on go-logging, formatting the
+// fields of a message as JSON object, e.g.
+// `2020-05-28 12:51:22 | INFO | user created | {"user":"alice"}`. The level
+// can be changed at runtime.
+func NewGoLoggingLogger(config requestcontext.LoggerConfig) Logger {
+	registry := requestcontext.NewLoggerRegistry(config)
+
+	return &goLoggingLogger{
+		name:     config.Name,
+		logger:   registry.MustCreate(config.Name),
+		registry: registry,
+	}
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type goLoggingLogger struct {
+	name     string
+	logger   requestcontext.Logger
+	registry requestcontext.LoggerRegistry
+	fields   []interface{}
+}
+
+// The message is passed as argument, not as format, so that percent signs in
+// messages and fields are not interpreted.
+
+func (l *goLoggingLogger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Debug(nil, "%s", formatLogFields(msg, logFields(l.fields, keyvals)))
+}
+
+func (l *goLoggingLogger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Info(nil, "%s", formatLogFields(msg, logFields(l.fields, keyvals)))
+}
+
+func (l *goLoggingLogger) Warn(msg string, keyvals ...interface{}) {
+	l.logger.Warning(nil, "%s", formatLogFields(msg, logFields(l.fields, keyvals)))
+}
+
+func (l *goLoggingLogger) Error(msg string, keyvals ...interface{}) {
+	l.logger.Error(nil, "%s", formatLogFields(msg, logFields(l.fields, keyvals)))
+}
+
+func (l *goLoggingLogger) With(keyvals ...interface{}) Logger {
+	with := *l
+	with.fields = append(append([]interface{}{}, l.fields...), keyvals...)
+
+	return &with
+}
+
+func (l *goLoggingLogger) Level() string {
+	level, err := l.registry.GetLevel(l.name)
+	if err != nil || level == "" {
+		// go-logging logs everything if no level is configured.
+		return "DEBUG"
+	}
+
+	return strings.ToUpper(level)
+}
+
+func (l *goLoggingLogger) SetLevel(level string) error {
+	level, err := parseLogLevel(level)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	if err := l.registry.SetLevel(l.name, level); err != nil {
+		return errgo.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/juju/errgo"
+)
+
+// LogRecord is a message recorded by the RecordingLogger.
+type LogRecord struct {
+	Level   string
+	Message string
+	Fields  map[string]interface{}
+}
+
+// RecordingLogger keeps all messages in memory, e.g. to verify logging in
+// tests. Loggers created using With record into the same list.
+type RecordingLogger struct {
+	store  *logStore
+	fields []interface{}
+}
+
+// NewRecordingLogger creates a RecordingLogger recording all levels.
+func NewRecordingLogger() *RecordingLogger {
+	return &RecordingLogger{store: &logStore{level: "DEBUG"}}
+}
+
+// Records returns a copy of the recorded messages.
+func (l *RecordingLogger) Records() []LogRecord {
+	l.store.mutex.Lock()
+	defer l.store.mutex.Unlock()
+
+	return append([]LogRecord{}, l.store.records...)
+}
+
+func (l *RecordingLogger) Debug(msg string, keyvals ...interface{}) {
+	l.record("DEBUG", msg, keyvals)
+}
+
+func (l *RecordingLogger) Info(msg string, keyvals ...interface{}) {
+	l.record("INFO", msg, keyvals)
+}
+
+func (l *RecordingLogger) Warn(msg string, keyvals ...interface{}) {
+	l.record("WARNING", msg, keyvals)
+}
+
+func (l *RecordingLogger) Error(msg string, keyvals ...interface{}) {
+	l.record("ERROR", msg, keyvals)
+}
+
+func (l *RecordingLogger) With(keyvals ...interface{}) Logger {
+	return &RecordingLogger{
+		store:  l.store,
+		fields: append(append([]interface{}{}, l.fields...), keyvals...),
+	}
+}
+
+func (l *RecordingLogger) Level() string {
+	l.store.mutex.Lock()
+	defer l.store.mutex.Unlock()
+
+	return l.store.level
+}
+
+func (l *RecordingLogger) SetLevel(level string) error {
+	level, err := parseLogLevel(level)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	l.store.mutex.Lock()
+	defer l.store.mutex.Unlock()
+
+	l.store.level = level
+
+	return nil
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type logStore struct {
+	mutex   sync.Mutex
+	level   string
+	records []LogRecord
+}
+
+func (l *RecordingLogger) record(level, msg string, keyvals []interface{}) {
+	l.store.mutex.Lock()
+	defer l.store.mutex.Unlock()
+
+	if logLevelRanks[level] < logLevelRanks[l.store.level] {
+		return
+	}
+
+	l.store.records = append(l.store.records, LogRecord{
+		Level:   level,
+		Message: msg,
+		Fields:  logFields(l.fields, keyvals),
+	})
+}
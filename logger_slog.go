@@ -0,0 +1,82 @@
+//go:build go1.21
+
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/juju/errgo"
+)
+
+// NewSlogLogger creates a Logger based on log/slog. If level is the
+// slog.LevelVar used by the handler of the logger, the level can be changed
+// at runtime, otherwise SetLevel fails. It is only available when building
+// with Go 1.21 or newer, which introduced log/slog.
+func NewSlogLogger(logger *slog.Logger, level *slog.LevelVar) Logger {
+	return &slogLogger{logger: logger, level: level}
+}
+
+//------------------------------------------------------------------------------
+// private
+
+// slogLevels maps the levels of Leveler to slog levels. NOTICE and CRITICAL
+// lie between the levels defined by slog.
+var slogLevels = map[string]slog.Level{
+	"DEBUG":    slog.LevelDebug,
+	"INFO":     slog.LevelInfo,
+	"NOTICE":   slog.LevelInfo + 2,
+	"WARNING":  slog.LevelWarn,
+	"ERROR":    slog.LevelError,
+	"CRITICAL": slog.LevelError + 4,
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+	level  *slog.LevelVar
+}
+
+func (l *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Debug(msg, keyvals...)
+}
+
+func (l *slogLogger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Info(msg, keyvals...)
+}
+
+func (l *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	l.logger.Warn(msg, keyvals...)
+}
+
+func (l *slogLogger) Error(msg string, keyvals ...interface{}) {
+	l.logger.Error(msg, keyvals...)
+}
+
+func (l *slogLogger) With(keyvals ...interface{}) Logger {
+	return &slogLogger{logger: l.logger.With(keyvals...), level: l.level}
+}
+
+// Level returns the lowest level enabled by the handler of the logger.
+func (l *slogLogger) Level() string {
+	for _, name := range []string{"DEBUG", "INFO", "NOTICE", "WARNING", "ERROR"} {
+		if l.logger.Enabled(context.Background(), slogLevels[name]) {
+			return name
+		}
+	}
+
+	return "CRITICAL"
+}
+
+func (l *slogLogger) SetLevel(level string) error {
+	if l.level == nil {
+		return errgo.Mask(LevelNotChangeableError, errgo.Any)
+	}
+
+	level, err := parseLogLevel(level)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	l.level.Set(slogLevels[level])
+
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build go1.21
+
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	srvPkg "github.com/giantswarm/middleware-server"
+)
+
+var _ = Describe("slog logger", func() {
+	var (
+		out    *bytes.Buffer
+		logger srvPkg.Logger
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		level := &slog.LevelVar{}
+		level.Set(slog.LevelInfo)
+		logger = srvPkg.NewSlogLogger(slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level})), level)
+	})
+
+	It("should log fields as attributes", func() {
+		logger.With("request_id", "abc").Info("hello", "user", "alice")
+
+		var record map[string]interface{}
+		Expect(json.Unmarshal(out.Bytes(), &record)).To(BeNil())
+		Expect(record).To(HaveKeyWithValue("msg", "hello"))
+		Expect(record).To(HaveKeyWithValue("request_id", "abc"))
+		Expect(record).To(HaveKeyWithValue("user", "alice"))
+	})
+
+	It("should change the level", func() {
+		leveler := logger.(srvPkg.Leveler)
+		Expect(leveler.Level()).To(Equal("INFO"))
+
+		logger.Debug("hidden")
+		Expect(out.Len()).To(Equal(0))
+
+		Expect(leveler.SetLevel("DEBUG")).To(BeNil())
+		logger.Debug("shown")
+		Expect(out.String()).To(ContainSubstring("shown"))
+	})
+
+	It("should not change the level without level var", func() {
+		logger = srvPkg.NewSlogLogger(slog.New(slog.NewJSONHandler(out, nil)), nil)
+
+		err := logger.(srvPkg.Leveler).SetLevel("DEBUG")
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,127 @@
+package server_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	srvPkg "github.com/giantswarm/middleware-server"
+)
+
+var _ = Describe("Logger", func() {
+	Describe("recording logger", func() {
+		var logger *srvPkg.RecordingLogger
+
+		BeforeEach(func() {
+			logger = srvPkg.NewRecordingLogger()
+		})
+
+		It("should record messages with fields", func() {
+			logger.With("component", "test").Warn("something happened", "count", 3, "error", errors.New("failed"))
+
+			Expect(logger.Records()).To(Equal([]srvPkg.LogRecord{{
+				Level:   "WARNING",
+				Message: "something happened",
+				Fields:  map[string]interface{}{"component": "test", "count": 3, "error": "failed"},
+			}}))
+		})
+
+		It("should not record messages below its level", func() {
+			Expect(logger.SetLevel("warn")).To(BeNil())
+			logger.Info("hidden")
+			logger.Error("shown")
+
+			Expect(logger.Records()).To(HaveLen(1))
+			Expect(logger.Records()[0].Message).To(Equal("shown"))
+		})
+
+		It("should reject invalid levels", func() {
+			Expect(logger.SetLevel("VERBOSE")).NotTo(BeNil())
+			Expect(logger.Level()).To(Equal("DEBUG"))
+		})
+	})
+
+	Describe("server logging", func() {
+		var (
+			srv    *srvPkg.Server
+			logger *srvPkg.RecordingLogger
+		)
+
+		BeforeEach(func() {
+			logger = srvPkg.NewRecordingLogger()
+
+			srv = srvPkg.NewServer("", "")
+			srv.SetLogger(logger)
+			srv.SetAccessReporter(nil)
+			srv.Serve("GET", "/fail", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				ctx.Logger().Info("about to fail", "user", "alice")
+				return errors.New("boom")
+			})
+		})
+
+		It("should add the request ID and route name as fields", func() {
+			req := httptest.NewRequest("GET", "/fail", nil)
+			req.Header.Set(srvPkg.RequestIDHeader, "abc")
+			serve(srv, req)
+
+			records := logger.Records()
+			Expect(records).To(HaveLen(2))
+
+			Expect(records[0].Message).To(Equal("about to fail"))
+			Expect(records[0].Fields).To(HaveKeyWithValue("user", "alice"))
+			Expect(records[0].Fields).To(HaveKeyWithValue("route", "GET /fail"))
+			Expect(records[0].Fields["request_id"]).To(HavePrefix("abc, "))
+
+			Expect(records[1].Level).To(Equal("ERROR"))
+			Expect(records[1].Message).To(Equal("middleware failed"))
+			Expect(records[1].Fields).To(HaveKeyWithValue("error", "boom"))
+			Expect(records[1].Fields).To(HaveKeyWithValue("route", "GET /fail"))
+		})
+
+		It("should log the request ID set by middlewares", func() {
+			srv.Serve("GET", "/renamed", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				ctx.SetRequestID("new-id")
+				ctx.Logger().Info("renamed")
+				return errors.New("boom")
+			})
+			serve(srv, httptest.NewRequest("GET", "/renamed", nil))
+
+			records := logger.Records()
+			Expect(records).To(HaveLen(2))
+			for _, record := range records {
+				Expect(record.Fields).To(HaveKeyWithValue("request_id", "new-id"))
+				Expect(record.Fields).To(HaveKeyWithValue("route", "GET /renamed"))
+			}
+		})
+
+		It("should control the level of the server logger", func() {
+			srv.SetLogLevel("ERROR")
+			serve(srv, httptest.NewRequest("GET", "/fail", nil))
+
+			Expect(logger.Records()).To(HaveLen(1))
+			Expect(srv.LogLevels()).To(Equal(map[string]string{"server": "ERROR"}))
+		})
+
+		It("should log requests with structured fields", func() {
+			srv.SetAccessReporter(srvPkg.ExtendedAccessReporter)
+			req := httptest.NewRequest("GET", "/fail", nil)
+			req.Header.Set("User-Agent", "test-agent")
+			serve(srv, req)
+
+			records := logger.Records()
+			Expect(records).To(HaveLen(3))
+			Expect(records[2].Level).To(Equal("INFO"))
+			Expect(records[2].Message).To(Equal("request"))
+			Expect(records[2].Fields).To(HaveKeyWithValue("method", "GET"))
+			Expect(records[2].Fields).To(HaveKeyWithValue("uri", "/fail"))
+			Expect(records[2].Fields).To(HaveKeyWithValue("status", http.StatusInternalServerError))
+			Expect(records[2].Fields).To(HaveKeyWithValue("size", int64(4)))
+			Expect(records[2].Fields).To(HaveKey("duration_ms"))
+			Expect(records[2].Fields).To(HaveKeyWithValue("user_agent", "test-agent"))
+			Expect(records[2].Fields).To(HaveKeyWithValue("route", "GET /fail"))
+		})
+	})
+})
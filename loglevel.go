@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	// ServerLoggerName is the name the logger of the server is registered
+	// with, see `Server.RegisterLogger`.
+	ServerLoggerName = "server"
+)
+
+// LogLevelChange is the body accepted by NewLogLevelMiddleware. If Logger is
+// empty, the level of all loggers is changed.
+type LogLevelChange struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+}
+
+// RegisterLogger makes the level of the given logger changeable at runtime
+// under the given name, e.g. the logger of the application. Loggers not
+// implementing Leveler cannot be controlled and are unregistered.
+func (s *Server) RegisterLogger(name string, logger Logger) {
+	s.loggersMutex.Lock()
+	defer s.loggersMutex.Unlock()
+
+	if leveler, ok := logger.(Leveler); ok {
+		s.loggers[name] = leveler
+	} else {
+		delete(s.loggers, name)
+	}
+}
+
+// LogLevels returns the current level of every registered logger by name.
+func (s *Server) LogLevels() map[string]string {
+	s.loggersMutex.Lock()
+	defer s.loggersMutex.Unlock()
+
+	levels := map[string]string{}
+	for name, leveler := range s.loggers {
+		levels[name] = leveler.Level()
+	}
+
+	return levels
+}
+
+// ChangeLogLevel sets the level of the named logger, e.g. "DEBUG". The change
+// is logged together with the given source, e.g. the client requesting it.
+// Use IsLoggerNotFound to check for unknown loggers.
+func (s *Server) ChangeLogLevel(name, level, source string) error {
+	s.loggersMutex.Lock()
+	leveler, ok := s.loggers[name]
+	s.loggersMutex.Unlock()
+	if !ok {
+		return errgo.Mask(LoggerNotFoundError, errgo.Any)
+	}
+
+	old := leveler.Level()
+	if err := leveler.SetLevel(level); err != nil {
+		return errgo.Mask(err)
+	}
+
+	// Logged as warning, so the change shows up at all but the highest levels.
+	s.Logger.Warn("log level changed", "logger", name, "from", old, "to", leveler.Level(), "source", source)
+
+	return nil
+}
+
+// ToggleDebugLogging switches all loggers to DEBUG, or back to the levels
+// they had before, and returns true if debug logging is enabled now. The
+// server calls this on SIGUSR1.
+func (s *Server) ToggleDebugLogging(source string) bool {
+	s.logLevelMutex.Lock()
+	defer s.logLevelMutex.Unlock()
+
+	if s.debugToggle != nil {
+		for name, level := range s.debugToggle {
+			if err := s.ChangeLogLevel(name, level, source); err != nil {
+				s.Logger.Error("changing log level failed", "logger", name, "error", err)
+			}
+		}
+		s.debugToggle = nil
+
+		return false
+	}
+
+	s.debugToggle = s.LogLevels()
+	for name := range s.debugToggle {
+		if err := s.ChangeLogLevel(name, "DEBUG", source); err != nil {
+			s.Logger.Error("changing log level failed", "logger", name, "error", err)
+		}
+	}
+
+	return true
+}
+
+// NewLogLevelMiddleware provides a middleware that responds the levels of all
+// loggers of the server as JSON on GET, and changes them on PUT or POST using
+// a LogLevelChange body. E.g. one can register this under
+// /admin/log-levels, which should not be reachable publicly.
+func NewLogLevelMiddleware(s *Server) Middleware {
+	return func(res http.ResponseWriter, req *http.Request, ctx *Context) error {
+		switch req.Method {
+		case "GET", "HEAD":
+			return ctx.Response.Json(s.LogLevels(), http.StatusOK)
+		case "PUT", "POST":
+		default:
+			res.Header().Set("Allow", "GET, HEAD, PUT, POST")
+			return ctx.Response.Error("method not allowed", http.StatusMethodNotAllowed)
+		}
+
+		var change LogLevelChange
+		if err := json.NewDecoder(req.Body).Decode(&change); err != nil {
+			return ctx.Response.Error("invalid log level change: "+err.Error(), http.StatusBadRequest)
+		}
+
+		names := []string{change.Logger}
+		if change.Logger == "" {
+			names = names[:0]
+			for name := range s.LogLevels() {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+
+		source := logLevelChangeSource(req, ctx)
+		for _, name := range names {
+			if err := s.ChangeLogLevel(name, change.Level, source); IsLoggerNotFound(err) {
+				return ctx.Response.Error(fmt.Sprintf("logger '%s' not found", name), http.StatusNotFound)
+			} else if err != nil {
+				return ctx.Response.Error(err.Error(), http.StatusBadRequest)
+			}
+		}
+
+		return ctx.Response.Json(s.LogLevels(), http.StatusOK)
+	}
+}
+
+//------------------------------------------------------------------------------
+// private
+
+// logLevelChangeSource describes the client changing a log level for the
+// audit log.
+func logLevelChangeSource(req *http.Request, ctx *Context) string {
+	source := fmt.Sprintf("%s %s from %s (request %s)", req.Method, req.URL.Path, ctx.ClientIP(), ctx.RequestID())
+	if ctx.entry != nil && ctx.entry.Principal() != "" {
+		source += " as " + ctx.entry.Principal()
+	}
+
+	return source
+}
+
+func isDebugSignal(sig os.Signal) bool {
+	for _, s := range debugSignals {
+		if s == sig {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/giantswarm/request-context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	srvPkg "github.com/giantswarm/middleware-server"
+)
+
+var _ = Describe("log levels", func() {
+	var srv *srvPkg.Server
+
+	BeforeEach(func() {
+		srv = srvPkg.NewServer("", "")
+		srv.SetAccessReporter(nil)
+		srv.SetLogLevel("INFO")
+		srv.RegisterLogger("app", srvPkg.NewGoLoggingLogger(requestcontext.LoggerConfig{Name: "app", Level: "ERROR"}))
+
+		for _, method := range []string{"GET", "PUT"} {
+			srv.Serve(method, "/admin/log-levels", srvPkg.NewLogLevelMiddleware(srv))
+		}
+	})
+
+	It("should apply the configured levels", func() {
+		Expect(srv.LogLevels()).To(Equal(map[string]string{"server": "INFO", "app": "ERROR"}))
+	})
+
+	It("should report unknown loggers", func() {
+		err := srv.ChangeLogLevel("unknown", "DEBUG", "test")
+		Expect(srvPkg.IsLoggerNotFound(err)).To(BeTrue())
+	})
+
+	It("should reject invalid levels", func() {
+		Expect(srv.ChangeLogLevel("app", "VERBOSE", "test")).NotTo(BeNil())
+		Expect(srv.LogLevels()["app"]).To(Equal("ERROR"))
+	})
+
+	It("should toggle debug logging and restore the previous levels", func() {
+		Expect(srv.ToggleDebugLogging("test")).To(BeTrue())
+		Expect(srv.LogLevels()).To(Equal(map[string]string{"server": "DEBUG", "app": "DEBUG"}))
+
+		Expect(srv.ToggleDebugLogging("test")).To(BeFalse())
+		Expect(srv.LogLevels()).To(Equal(map[string]string{"server": "INFO", "app": "ERROR"}))
+	})
+
+	Describe("admin endpoint", func() {
+		put := func(body string) *httptest.ResponseRecorder {
+			return serve(srv, httptest.NewRequest("PUT", "/admin/log-levels", strings.NewReader(body)))
+		}
+
+		It("should list the levels", func() {
+			res := serve(srv, httptest.NewRequest("GET", "/admin/log-levels", nil))
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			var levels map[string]string
+			Expect(json.Unmarshal(res.Body.Bytes(), &levels)).To(BeNil())
+			Expect(levels).To(Equal(map[string]string{"server": "INFO", "app": "ERROR"}))
+		})
+
+		It("should change the level of a single logger", func() {
+			res := put(`{"logger": "app", "level": "debug"}`)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(srv.LogLevels()).To(Equal(map[string]string{"server": "INFO", "app": "DEBUG"}))
+		})
+
+		It("should change the level of all loggers", func() {
+			res := put(`{"level": "WARNING"}`)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(srv.LogLevels()).To(Equal(map[string]string{"server": "WARNING", "app": "WARNING"}))
+		})
+
+		It("should respond 404 for unknown loggers", func() {
+			Expect(put(`{"logger": "unknown", "level": "DEBUG"}`).Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should respond 400 for invalid levels", func() {
+			Expect(put(`{"logger": "app", "level": "VERBOSE"}`).Code).To(Equal(http.StatusBadRequest))
+			Expect(put(`not json`).Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -0,0 +1,310 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// DefaultDurationBuckets are the upper bounds in seconds of the request
+	// duration histogram.
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// DefaultSizeBuckets are the upper bounds in bytes of the response size
+	// histogram.
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+	processStart = time.Now()
+)
+
+// Metrics records the request rate, errors and durations (RED) of every
+// route, as well as process and Go runtime metrics, and exposes them in the
+// Prometheus text format. Register it using `Server.SetMetrics` and serve it
+// using NewMetricsMiddleware.
+type Metrics struct {
+	namespace       string
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	mutex    sync.Mutex
+	requests map[requestLabels]*requestSeries
+	inFlight map[inFlightLabels]int64
+}
+
+// NewMetrics creates a new Metrics. All request metrics are prefixed with
+// the given namespace, e.g. "myapp_http_requests_total".
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		namespace:       namespace,
+		durationBuckets: DefaultDurationBuckets,
+		sizeBuckets:     DefaultSizeBuckets,
+		requests:        map[requestLabels]*requestSeries{},
+		inFlight:        map[inFlightLabels]int64{},
+	}
+}
+
+// WriteTo writes all metrics in the Prometheus text format to w.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+
+	m.writeRequestMetrics(cw)
+	m.writeRuntimeMetrics(cw)
+
+	if cw.err == nil {
+		cw.err = bw.Flush()
+	}
+
+	return cw.n, cw.err
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type requestLabels struct {
+	route  string
+	method string
+	code   string
+}
+
+type inFlightLabels struct {
+	route  string
+	method string
+}
+
+type requestSeries struct {
+	count           uint64
+	durationSum     float64
+	durationBuckets []uint64
+	sizeSum         float64
+	sizeBuckets     []uint64
+}
+
+// track counts the request as in flight until the returned function is
+// called.
+func (m *Metrics) track(req *http.Request) func() {
+	labels := inFlightLabels{route: currentRouteName(req), method: req.Method}
+
+	m.mutex.Lock()
+	m.inFlight[labels]++
+	m.mutex.Unlock()
+
+	return func() {
+		m.mutex.Lock()
+		m.inFlight[labels]--
+		m.mutex.Unlock()
+	}
+}
+
+// report is an AccessReporter recording the finished request.
+func (m *Metrics) report(entry *AccessEntry) {
+	labels := requestLabels{
+		route:  entry.RouteName(),
+		method: entry.RequestMethod(),
+		code:   strconv.Itoa(entry.StatusCode()/100) + "xx",
+	}
+	duration := entry.Duration().Seconds()
+	size := float64(entry.Size())
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	series, ok := m.requests[labels]
+	if !ok {
+		series = &requestSeries{
+			durationBuckets: make([]uint64, len(m.durationBuckets)),
+			sizeBuckets:     make([]uint64, len(m.sizeBuckets)),
+		}
+		m.requests[labels] = series
+	}
+
+	series.count++
+	series.durationSum += duration
+	series.sizeSum += size
+	observeBuckets(series.durationBuckets, m.durationBuckets, duration)
+	observeBuckets(series.sizeBuckets, m.sizeBuckets, size)
+}
+
+func (m *Metrics) writeRequestMetrics(w *countingWriter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := make([]requestLabels, 0, len(m.requests))
+	for labels := range m.requests {
+		keys = append(keys, labels)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].route+keys[i].method+keys[i].code < keys[j].route+keys[j].method+keys[j].code
+	})
+
+	name := m.metricName("http_requests_total")
+	w.printf("# HELP %s Total number of HTTP requests.\n# TYPE %s counter\n", name, name)
+	for _, labels := range keys {
+		w.printf("%s{%s} %d\n", name, labels.String(), m.requests[labels].count)
+	}
+
+	name = m.metricName("http_request_duration_seconds")
+	w.printf("# HELP %s Duration of HTTP requests in seconds.\n# TYPE %s histogram\n", name, name)
+	for _, labels := range keys {
+		series := m.requests[labels]
+		writeHistogram(w, name, labels.String(), m.durationBuckets, series.durationBuckets, series.durationSum, series.count)
+	}
+
+	name = m.metricName("http_response_size_bytes")
+	w.printf("# HELP %s Size of HTTP responses in bytes.\n# TYPE %s histogram\n", name, name)
+	for _, labels := range keys {
+		series := m.requests[labels]
+		writeHistogram(w, name, labels.String(), m.sizeBuckets, series.sizeBuckets, series.sizeSum, series.count)
+	}
+
+	inFlight := make([]inFlightLabels, 0, len(m.inFlight))
+	for labels := range m.inFlight {
+		inFlight = append(inFlight, labels)
+	}
+	sort.Slice(inFlight, func(i, j int) bool {
+		return inFlight[i].route+inFlight[i].method < inFlight[j].route+inFlight[j].method
+	})
+
+	name = m.metricName("http_requests_in_flight")
+	w.printf("# HELP %s Number of HTTP requests currently processed.\n# TYPE %s gauge\n", name, name)
+	for _, labels := range inFlight {
+		w.printf("%s{route=%s,method=%s} %d\n", name, quoteLabel(labels.route), quoteLabel(labels.method), m.inFlight[labels])
+	}
+}
+
+func (m *Metrics) writeRuntimeMetrics(w *countingWriter) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	writeGauge(w, "go_info", "Information about the Go environment.", "version="+quoteLabel(runtime.Version()), 1)
+	writeGauge(w, "go_goroutines", "Number of goroutines that currently exist.", "", float64(runtime.NumGoroutine()))
+	writeGauge(w, "go_threads", "Number of OS threads created.", "", float64(threads))
+	writeGauge(w, "go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "", float64(mem.Alloc))
+	writeGauge(w, "go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", "", float64(mem.HeapInuse))
+	writeGauge(w, "go_memstats_sys_bytes", "Number of bytes obtained from system.", "", float64(mem.Sys))
+	writeGauge(w, "go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of last garbage collection.", "", float64(mem.LastGC)/1e9)
+	w.printf("# HELP go_gc_cycles_total Number of completed GC cycles.\n# TYPE go_gc_cycles_total counter\ngo_gc_cycles_total %d\n", mem.NumGC)
+
+	writeGauge(w, "process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "", float64(processStart.UnixNano())/1e9)
+	if fds, err := ioutil.ReadDir("/proc/self/fd"); err == nil {
+		writeGauge(w, "process_open_fds", "Number of open file descriptors.", "", float64(len(fds)))
+	}
+	if rss, ok := residentMemory(); ok {
+		writeGauge(w, "process_resident_memory_bytes", "Resident memory size in bytes.", "", rss)
+	}
+}
+
+func (m *Metrics) metricName(name string) string {
+	if m.namespace == "" {
+		return name
+	}
+
+	return m.namespace + "_" + name
+}
+
+func (l requestLabels) String() string {
+	return "route=" + quoteLabel(l.route) + ",method=" + quoteLabel(l.method) + ",code=" + quoteLabel(l.code)
+}
+
+func observeBuckets(counts []uint64, bounds []float64, value float64) {
+	for i, bound := range bounds {
+		if value <= bound {
+			counts[i]++
+		}
+	}
+}
+
+func writeHistogram(w *countingWriter, name, labels string, bounds []float64, counts []uint64, sum float64, count uint64) {
+	for i, bound := range bounds {
+		w.printf("%s_bucket{%s,le=%s} %d\n", name, labels, quoteLabel(formatFloat(bound)), counts[i])
+	}
+	w.printf("%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, count)
+	w.printf("%s_sum{%s} %s\n", name, labels, formatFloat(sum))
+	w.printf("%s_count{%s} %d\n", name, labels, count)
+}
+
+func writeGauge(w *countingWriter, name, help, labels string, value float64) {
+	w.printf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	if labels != "" {
+		w.printf("%s{%s} %s\n", name, labels, formatFloat(value))
+	} else {
+		w.printf("%s %s\n", name, formatFloat(value))
+	}
+}
+
+// residentMemory reads the resident set size from /proc, which is only
+// available on Linux.
+func residentMemory() (float64, bool) {
+	raw, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, false
+	}
+
+	fields := strings.Fields(string(raw))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pages, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return pages * float64(os.Getpagesize()), true
+}
+
+func currentRouteName(req *http.Request) string {
+	if route := mux.CurrentRoute(req); route != nil && route.GetName() != "" {
+		return route.GetName()
+	}
+
+	return req.Method + " route-not-found"
+}
+
+func quoteLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return `"` + value + `"`
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) printf(format string, a ...interface{}) {
+	if cw.err != nil {
+		return
+	}
+
+	n, err := fmt.Fprintf(cw.w, format, a...)
+	cw.n += int64(n)
+	cw.err = err
+}
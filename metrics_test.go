@@ -0,0 +1,62 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	srvPkg "github.com/giantswarm/middleware-server"
+)
+
+var _ = Describe("metrics", func() {
+	var (
+		srv  *srvPkg.Server
+		rec  *httptest.ResponseRecorder
+		body string
+	)
+
+	BeforeEach(func() {
+		m := srvPkg.NewMetrics("test")
+
+		srv = srvPkg.NewServer("", "")
+		srv.SetMetrics(m)
+		srv.Serve("GET", "/hello", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+			return ctx.Response.PlainText("hello world", http.StatusOK)
+		})
+		srv.Serve("GET", "/metrics", srvPkg.NewMetricsMiddleware(m))
+
+		serve(srv, httptest.NewRequest("GET", "/hello", nil))
+		serve(srv, httptest.NewRequest("GET", "/hello", nil))
+		serve(srv, httptest.NewRequest("GET", "/unknown", nil))
+
+		rec = serve(srv, httptest.NewRequest("GET", "/metrics", nil))
+		body = rec.Body.String()
+	})
+
+	It("should respond in the Prometheus text format", func() {
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal(srvPkg.MetricsContentType))
+	})
+
+	It("should count requests per route, method and status class", func() {
+		Expect(body).To(ContainSubstring(`test_http_requests_total{route="GET /hello",method="GET",code="2xx"} 2` + "\n"))
+	})
+
+	It("should record the request duration and response size", func() {
+		Expect(body).To(ContainSubstring(`test_http_request_duration_seconds_count{route="GET /hello",method="GET",code="2xx"} 2` + "\n"))
+		Expect(body).To(ContainSubstring(`test_http_response_size_bytes_bucket{route="GET /hello",method="GET",code="2xx",le="100"} 2` + "\n"))
+		Expect(body).To(ContainSubstring(`test_http_response_size_bytes_sum{route="GET /hello",method="GET",code="2xx"} 22` + "\n"))
+	})
+
+	It("should track requests in flight", func() {
+		Expect(body).To(ContainSubstring(`test_http_requests_in_flight{route="GET /hello",method="GET"} 0` + "\n"))
+		Expect(body).To(ContainSubstring(`test_http_requests_in_flight{route="GET /metrics",method="GET"} 1` + "\n"))
+	})
+
+	It("should contain runtime metrics", func() {
+		Expect(body).To(MatchRegexp(`(?m)^go_goroutines \d+$`))
+		Expect(body).To(MatchRegexp(`(?m)^process_start_time_seconds \S+$`))
+	})
+})
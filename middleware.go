@@ -15,8 +15,26 @@ func NewWelcomeMiddleware(appName, version string) Middleware {
 	}
 }
 
+// NewMetricsMiddleware provides a middleware that responds the given metrics
+// in the Prometheus text format. E.g. one can register this under /metrics.
+func NewMetricsMiddleware(m *Metrics) Middleware {
+	return func(res http.ResponseWriter, rep *http.Request, ctx *Context) error {
+		res.Header().Set("Content-Type", MetricsContentType)
+		res.WriteHeader(http.StatusOK)
+
+		if _, err := m.WriteTo(res); err != nil {
+			return errgo.Mask(err)
+		}
+
+		return nil
+	}
+}
+
 // NewHealthcheckMiddleware provides a middleware that responds JSON formatted
 // information about a service. E.g. one can register this under /healthcheck.
+// Unhealthy services are reported with status code 503. The IETF health+json
+// format and Prometheus gauges are responded if requested by the Accept header
+// or the format query parameter, see HealthFormatJSON.
 func NewHealthcheckMiddleware(hc Healthchecker) Middleware {
 	return func(res http.ResponseWriter, rep *http.Request, ctx *Context) error {
 		hcRes, err := hc.Status()
@@ -24,6 +42,11 @@ func NewHealthcheckMiddleware(hc Healthchecker) Middleware {
 			return errgo.Mask(err)
 		}
 
-		return ctx.Response.Json(hcRes, http.StatusOK)
+		code := http.StatusOK
+		if !IsStatusAvailable(hcRes.Status) {
+			code = http.StatusServiceUnavailable
+		}
+
+		return writeHealth(rep, ctx, hcRes, code)
 	}
 }
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+// forwardingHeaders are the headers proxies use to report the original
+// request. They are removed from requests sent by untrusted peers.
+var forwardingHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host"}
+
+// Forwarded describes the original request as sent by the client, before it
+// passed any trusted proxies.
+type Forwarded struct {
+	ClientIP net.IP
+	Scheme   string
+	Host     string
+}
+
+// TrustedProxies resolves the IP, scheme and host of the client that sent a
+// request through one or more proxies. Forwarding headers are only taken into
+// account if the peer sending them is a trusted proxy.
+type TrustedProxies struct {
+	nets []*net.IPNet
+	hops int
+}
+
+// NewTrustedProxies creates TrustedProxies trusting the given networks in
+// CIDR notation, e.g. "10.0.0.0/8".
+func NewTrustedProxies(cidrs ...string) (*TrustedProxies, error) {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	return &TrustedProxies{nets: nets}, nil
+}
+
+// SetHops trusts the given number of proxies in front of the server,
+// regardless of their IP, e.g. 2 if the server sits behind a load balancer
+// and an ingress proxy with changing addresses.
+func (tp *TrustedProxies) SetHops(hops int) {
+	tp.hops = hops
+}
+
+// Resolve returns the original request as reported by trusted proxies. The
+// `Forwarded` header is preferred over the `X-Forwarded-For`,
+// `X-Forwarded-Proto` and `X-Forwarded-Host` headers. Hops are processed from
+// right to left, skipping trusted proxies, so clients cannot spoof their IP
+// by sending the headers themselves.
+func (tp *TrustedProxies) Resolve(req *http.Request) Forwarded {
+	result := Forwarded{
+		ClientIP: remoteIP(req),
+		Scheme:   "http",
+		Host:     req.Host,
+	}
+	if req.TLS != nil {
+		result.Scheme = "https"
+	}
+
+	if tp == nil || !tp.trusted(result.ClientIP, 0) {
+		return result
+	}
+
+	hops := forwardedHops(req.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := hops[i]
+		if hop.ip == nil {
+			break
+		}
+
+		result.ClientIP = hop.ip
+		if hop.proto != "" {
+			result.Scheme = hop.proto
+		}
+		if hop.host != "" {
+			result.Host = hop.host
+		}
+		if !tp.trusted(hop.ip, len(hops)-i) {
+			break
+		}
+	}
+
+	return result
+}
+
+// ClientIP returns the IP of the client, see Resolve.
+func (tp *TrustedProxies) ClientIP(req *http.Request) net.IP {
+	return tp.Resolve(req).ClientIP
+}
+
+// Trusted returns true if ip belongs to a trusted network.
+func (tp *TrustedProxies) Trusted(ip net.IP) bool {
+	if tp == nil {
+		return false
+	}
+
+	return containsIP(tp.nets, ip)
+}
+
+// SetTrustedProxies sets the proxies trusted to report the original request,
+// see `Context.ClientIP`, `Context.Scheme` and `Context.Host`. Once set,
+// forwarding headers sent by untrusted peers are removed from requests, so
+// middlewares cannot be tricked into reading spoofed values.
+func (s *Server) SetTrustedProxies(tp *TrustedProxies) {
+	s.trustedProxies = tp
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type forwardedHop struct {
+	ip    net.IP
+	proto string
+	host  string
+}
+
+// trusted returns true if the proxy at the given position, counting from the
+// direct peer at 0, is trusted by network or hop count.
+func (tp *TrustedProxies) trusted(ip net.IP, position int) bool {
+	return position < tp.hops || tp.Trusted(ip)
+}
+
+// stripUntrusted removes forwarding headers sent by untrusted peers.
+func (tp *TrustedProxies) stripUntrusted(req *http.Request) {
+	if tp == nil || tp.trusted(remoteIP(req), 0) {
+		return
+	}
+
+	for _, name := range forwardingHeaders {
+		req.Header.Del(name)
+	}
+}
+
+// forwardedHops returns the hops listed in the `Forwarded` header or, if not
+// present, in the `X-Forwarded-*` headers. Proxies usually overwrite
+// `X-Forwarded-Proto` and `X-Forwarded-Host`, so their last values are
+// attributed to the last hop.
+func forwardedHops(header http.Header) []forwardedHop {
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		return parseForwarded(values)
+	}
+
+	var hops []forwardedHop
+	for _, addr := range forwardedFor(header) {
+		hops = append(hops, forwardedHop{ip: net.ParseIP(addr)})
+	}
+	if len(hops) > 0 {
+		hops[len(hops)-1].proto = strings.ToLower(lastListValue(header.Values("X-Forwarded-Proto")))
+		hops[len(hops)-1].host = lastListValue(header.Values("X-Forwarded-Host"))
+	}
+
+	return hops
+}
+
+// parseForwarded parses `Forwarded` header values as specified by RFC 7239,
+// e.g. `for=192.0.2.60;proto=https;host=example.com, for="[2001:db8::1]:4711"`.
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+
+				v := strings.Trim(parts[1], `"`)
+				switch strings.ToLower(parts[0]) {
+				case "for":
+					hop.ip = parseNode(v)
+				case "proto":
+					hop.proto = strings.ToLower(v)
+				case "host":
+					hop.host = v
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
+
+// parseNode parses the IP of a `Forwarded` node, e.g. "192.0.2.60:8080" or
+// "[2001:db8::1]". Obfuscated and unknown nodes result in nil.
+func parseNode(node string) net.IP {
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(node)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	}
+
+	return net.ParseIP(host)
+}
+
+// forwardedFor returns the addresses listed in all `X-Forwarded-For` headers.
+func forwardedFor(header http.Header) []string {
+	var addrs []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			addrs = append(addrs, strings.TrimSpace(addr))
+		}
+	}
+
+	return addrs
+}
+
+func lastListValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	list := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(list[len(list)-1])
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the IP of the direct peer of the request.
+func remoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	return net.ParseIP(host)
+}
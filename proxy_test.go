@@ -0,0 +1,121 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	srvPkg "github.com/giantswarm/middleware-server"
+)
+
+var _ = Describe("trusted proxies", func() {
+	var (
+		srv *srvPkg.Server
+		req *http.Request
+		res map[string]string
+	)
+
+	BeforeEach(func() {
+		srv = srvPkg.NewServer("", "")
+		srv.SetAccessReporter(nil)
+		srv.Serve("GET", "/whoami", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+			return ctx.Response.Json(map[string]string{
+				"ip":     ctx.ClientIP().String(),
+				"scheme": ctx.Scheme(),
+				"host":   ctx.Host(),
+				"xff":    req.Header.Get("X-Forwarded-For"),
+			}, http.StatusOK)
+		})
+
+		req = httptest.NewRequest("GET", "/whoami", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.2")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "api.example.com")
+	})
+
+	JustBeforeEach(func() {
+		res = map[string]string{}
+		rec := serve(srv, req)
+		Expect(json.Unmarshal(rec.Body.Bytes(), &res)).To(BeNil())
+	})
+
+	Context("not configured", func() {
+		It("should ignore but keep forwarding headers", func() {
+			Expect(res["ip"]).To(Equal("192.0.2.1"))
+			Expect(res["scheme"]).To(Equal("http"))
+			Expect(res["host"]).To(Equal("example.com"))
+			Expect(res["xff"]).To(Equal("203.0.113.7, 10.0.0.2"))
+		})
+	})
+
+	Context("with an untrusted peer", func() {
+		BeforeEach(func() {
+			tp, err := srvPkg.NewTrustedProxies("10.0.0.0/8")
+			Expect(err).To(BeNil())
+			srv.SetTrustedProxies(tp)
+		})
+
+		It("should reject spoofed forwarding headers", func() {
+			Expect(res["ip"]).To(Equal("192.0.2.1"))
+			Expect(res["scheme"]).To(Equal("http"))
+			Expect(res["host"]).To(Equal("example.com"))
+			Expect(res["xff"]).To(BeEmpty())
+		})
+	})
+
+	Context("with trusted networks", func() {
+		BeforeEach(func() {
+			tp, err := srvPkg.NewTrustedProxies("192.0.2.0/24", "10.0.0.0/8")
+			Expect(err).To(BeNil())
+			srv.SetTrustedProxies(tp)
+		})
+
+		It("should resolve the original request", func() {
+			Expect(res["ip"]).To(Equal("203.0.113.7"))
+			Expect(res["scheme"]).To(Equal("https"))
+			Expect(res["host"]).To(Equal("api.example.com"))
+			Expect(res["xff"]).To(Equal("203.0.113.7, 10.0.0.2"))
+		})
+
+		Context("and a spoofed hop", func() {
+			BeforeEach(func() {
+				req.Header.Set("X-Forwarded-For", "10.1.1.1, 203.0.113.7, 10.0.0.2")
+			})
+
+			It("should stop at the first untrusted hop", func() {
+				Expect(res["ip"]).To(Equal("203.0.113.7"))
+			})
+		})
+
+		Context("and a Forwarded header", func() {
+			BeforeEach(func() {
+				req.Header.Set("Forwarded", `for="[2001:db8::1]:4711";proto=https;host=www.example.com, for=10.0.0.2;proto=http`)
+			})
+
+			It("should prefer the Forwarded header", func() {
+				Expect(res["ip"]).To(Equal("2001:db8::1"))
+				Expect(res["scheme"]).To(Equal("https"))
+				Expect(res["host"]).To(Equal("www.example.com"))
+			})
+		})
+	})
+
+	Context("with a hop count", func() {
+		BeforeEach(func() {
+			tp, err := srvPkg.NewTrustedProxies()
+			Expect(err).To(BeNil())
+			tp.SetHops(2)
+			srv.SetTrustedProxies(tp)
+
+			req.Header.Set("X-Forwarded-For", "10.1.1.1, 203.0.113.7, 198.51.100.2")
+		})
+
+		It("should trust the given number of proxies", func() {
+			Expect(res["ip"]).To(Equal("203.0.113.7"))
+			Expect(res["scheme"]).To(Equal("https"))
+		})
+	})
+})
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultRequestIDMaxLength = 128
+
+	// LegacyClientIDHeader is the header older clients send their ID in,
+	// see `RequestIDOptions.LegacyClientID`.
+	LegacyClientIDHeader = "X-Client-ID"
+)
+
+var (
+	// DefaultRequestIDHeaders are the headers read by default to get the ID
+	// sent by clients.
+	DefaultRequestIDHeaders = []string{RequestIDHeader}
+)
+
+// RequestIDPolicy defines how IDs sent by clients are treated, see
+// `RequestIDOptions.Headers`.
+type RequestIDPolicy int
+
+const (
+	// RequestIDChain appends a new ID to the one sent by the client, e.g.
+	// "client-id, cu2jdtczhimlb3y7", so requests can be followed across
+	// services. This is the default.
+	RequestIDChain RequestIDPolicy = iota
+
+	// RequestIDReuse uses the ID sent by the client, if any.
+	RequestIDReuse
+
+	// RequestIDReplace ignores IDs sent by clients and always creates a new
+	// one.
+	RequestIDReplace
+)
+
+// RequestIDOptions configures how the ID of every request is determined. New
+// IDs are created using `Server.IDFactory`, e.g. NewUUIDv7Factory.
+type RequestIDOptions struct {
+	// Policy defines whether IDs sent by clients are chained, reused or
+	// replaced. Defaults to RequestIDChain. Use RequestIDReplace to not accept
+	// IDs sent by clients at all.
+	Policy RequestIDPolicy
+
+	// Headers are the headers read to get the ID sent by the client, in order
+	// of priority. The first one set is used. Defaults to
+	// DefaultRequestIDHeaders.
+	Headers []string
+
+	// LegacyClientID uses the LegacyClientIDHeader instead, if the client
+	// sent it together with one of Headers. Older clients send both, their
+	// client ID and the request ID, while only the client ID is meaningful.
+	LegacyClientID bool
+
+	// MaxLength is the maximum number of characters kept from IDs sent by
+	// clients. Defaults to DefaultRequestIDMaxLength.
+	MaxLength int
+
+	// Validate optionally checks IDs sent by clients after sanitizing them.
+	// Invalid IDs are ignored, as if the client did not send any.
+	Validate func(id string) bool
+
+	// ResponseHeader is the header the ID is echoed in, so clients can refer
+	// to it, e.g. in bug reports, and sent to other services using
+	// `Context.Transport`. Defaults to the first of Headers.
+	ResponseHeader string
+}
+
+// SetRequestIDOptions configures how the ID of every request is determined,
+// see RequestIDOptions.
+func (s *Server) SetRequestIDOptions(options RequestIDOptions) {
+	s.requestIDOptions = options.withDefaults()
+}
+
+// SanitizeRequestID removes all characters from id, which are not letters,
+// digits or one of `-_.:/+=@,` and spaces, and truncates it to maxLength
+// characters. This prevents clients from injecting e.g. line breaks into
+// logs.
+func SanitizeRequestID(id string, maxLength int) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("-_.:/+=@, ", r):
+			return r
+		}
+		return -1
+	}, id)
+
+	if len(sanitized) > maxLength {
+		sanitized = sanitized[:maxLength]
+	}
+
+	return strings.TrimSpace(sanitized)
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the given request ID.
+// The server adds the ID to the context of every request.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or an empty
+// string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type requestIDContextKey struct{}
+
+// withDefaults returns a copy of the options with defaults applied to unset
+// fields. They are applied again on use, so servers not created using
+// NewServer work as well.
+func (options RequestIDOptions) withDefaults() RequestIDOptions {
+	if options.MaxLength <= 0 {
+		options.MaxLength = DefaultRequestIDMaxLength
+	}
+	if len(options.Headers) == 0 {
+		options.Headers = DefaultRequestIDHeaders
+	}
+	if options.ResponseHeader == "" {
+		options.ResponseHeader = options.Headers[0]
+	}
+
+	return options
+}
+
+// requestID determines the ID of req according to the given options.
+func (s *Server) requestID(req *http.Request, options RequestIDOptions) string {
+	if options.Policy == RequestIDReplace {
+		return s.IDFactory()
+	}
+
+	var requestID string
+	for _, header := range options.Headers {
+		if requestID = req.Header.Get(header); requestID != "" {
+			break
+		}
+	}
+
+	if options.LegacyClientID && requestID != "" {
+		if clientID := req.Header.Get(LegacyClientIDHeader); clientID != "" {
+			requestID = clientID
+		}
+	}
+
+	requestID = SanitizeRequestID(requestID, options.MaxLength)
+	if requestID != "" && options.Validate != nil && !options.Validate(requestID) {
+		requestID = ""
+	}
+
+	switch {
+	case requestID == "":
+		return s.IDFactory()
+	case options.Policy == RequestIDReuse:
+		return requestID
+	default:
+		return requestID + ", " + s.IDFactory()
+	}
+}
@@ -0,0 +1,258 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/gorilla/mux"
+
+	srvPkg "github.com/giantswarm/middleware-server"
+)
+
+var _ = Describe("request ID", func() {
+	Describe("factories", func() {
+		It("should create random UUIDs", func() {
+			id := srvPkg.NewUUIDv4Factory()()
+			Expect(id).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+			Expect(srvPkg.NewUUIDv4Factory()()).NotTo(Equal(id))
+		})
+
+		It("should create UUIDs sorting by time", func() {
+			factory := srvPkg.NewUUIDv7Factory()
+			id := factory()
+			Expect(id).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+
+			var later string
+			Eventually(func() string {
+				later = factory()
+				return later[:13]
+			}).ShouldNot(Equal(id[:13]))
+			Expect(later > id).To(BeTrue())
+		})
+
+		It("should create ULIDs sorting by time", func() {
+			factory := srvPkg.NewULIDFactory()
+			id := factory()
+			Expect(id).To(MatchRegexp(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`))
+
+			var later string
+			Eventually(func() string {
+				later = factory()
+				return later[:10]
+			}).ShouldNot(Equal(id[:10]))
+			Expect(later > id).To(BeTrue())
+		})
+	})
+
+	It("should sanitize IDs", func() {
+		Expect(srvPkg.SanitizeRequestID("abc\n[ERROR] forged\r\"", 100)).To(Equal("abcERROR forged"))
+		Expect(srvPkg.SanitizeRequestID("0123456789", 4)).To(Equal("0123"))
+	})
+
+	Describe("policies", func() {
+		var srv *srvPkg.Server
+
+		BeforeEach(func() {
+			srv = srvPkg.NewServer("", "")
+			srv.SetAccessReporter(nil)
+			srv.IDFactory = func() string { return "new-id" }
+			srv.Serve("GET", "/id", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				return ctx.Response.PlainText(ctx.RequestID(), http.StatusOK)
+			})
+		})
+
+		requestID := func(id string) string {
+			req := httptest.NewRequest("GET", "/id", nil)
+			if id != "" {
+				req.Header.Set("X-Request-ID", id)
+			}
+			return serve(srv, req).Body.String()
+		}
+
+		It("should chain IDs by default", func() {
+			Expect(requestID("client-id")).To(Equal("client-id, new-id"))
+			Expect(requestID("")).To(Equal("new-id"))
+		})
+
+		It("should sanitize and truncate client IDs", func() {
+			Expect(requestID("client-id\x1b[31m")).To(Equal("client-id31m, new-id"))
+			Expect(requestID(strings.Repeat("a", 200))).To(Equal(strings.Repeat("a", srvPkg.DefaultRequestIDMaxLength) + ", new-id"))
+		})
+
+		It("should reuse client IDs", func() {
+			srv.SetRequestIDOptions(srvPkg.RequestIDOptions{Policy: srvPkg.RequestIDReuse, MaxLength: 8})
+			Expect(requestID("client-id")).To(Equal("client-i"))
+			Expect(requestID("")).To(Equal("new-id"))
+		})
+
+		It("should replace client IDs", func() {
+			srv.SetRequestIDOptions(srvPkg.RequestIDOptions{Policy: srvPkg.RequestIDReplace})
+			Expect(requestID("client-id")).To(Equal("new-id"))
+		})
+
+		It("should ignore invalid client IDs", func() {
+			srv.SetRequestIDOptions(srvPkg.RequestIDOptions{
+				Policy: srvPkg.RequestIDReuse,
+				Validate: func(id string) bool {
+					return strings.HasPrefix(id, "client-")
+				},
+			})
+			Expect(requestID("client-id")).To(Equal("client-id"))
+			Expect(requestID("forged")).To(Equal("new-id"))
+		})
+
+		Describe("headers", func() {
+			var req *http.Request
+
+			BeforeEach(func() {
+				req = httptest.NewRequest("GET", "/id", nil)
+				req.Header.Set("X-Request-ID", "request-id")
+				req.Header.Set("X-Client-ID", "client-id")
+				req.Header.Set("X-Correlation-ID", "correlation-id")
+			})
+
+			It("should ignore the client ID by default", func() {
+				Expect(serve(srv, req).Body.String()).To(Equal("request-id, new-id"))
+			})
+
+			It("should prefer the client ID if enabled", func() {
+				srv.SetRequestIDOptions(srvPkg.RequestIDOptions{LegacyClientID: true})
+				Expect(serve(srv, req).Body.String()).To(Equal("client-id, new-id"))
+
+				req.Header.Del("X-Request-ID")
+				Expect(serve(srv, req).Body.String()).To(Equal("new-id"))
+			})
+
+			It("should read the configured headers in order", func() {
+				srv.SetRequestIDOptions(srvPkg.RequestIDOptions{
+					Headers: []string{"X-Correlation-ID", "X-Request-ID"},
+				})
+				Expect(serve(srv, req).Body.String()).To(Equal("correlation-id, new-id"))
+
+				req.Header.Del("X-Correlation-ID")
+				Expect(serve(srv, req).Body.String()).To(Equal("request-id, new-id"))
+			})
+		})
+
+		It("should apply the defaults to servers not created using NewServer", func() {
+			srv := &srvPkg.Server{
+				Router:    mux.NewRouter(),
+				Logger:    srvPkg.NewRecordingLogger(),
+				IDFactory: func() string { return "new-id" },
+			}
+			srv.Serve("GET", "/id", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				return ctx.Response.PlainText(ctx.RequestID(), http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/id", nil)
+			req.Header.Set("X-Request-ID", "client-id")
+			res := serve(srv, req)
+
+			Expect(res.Body.String()).To(Equal("client-id, new-id"))
+			Expect(res.Header().Get("X-Request-ID")).To(Equal("client-id, new-id"))
+		})
+	})
+
+	Describe("propagation", func() {
+		var (
+			srv      *srvPkg.Server
+			upstream *httptest.Server
+			received http.Header
+		)
+
+		BeforeEach(func() {
+			upstream = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				received = req.Header
+			}))
+
+			srv = srvPkg.NewServer("", "")
+			srv.SetAccessReporter(nil)
+			srv.Serve("GET", "/proxy", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				client := &http.Client{Transport: ctx.Transport(nil)}
+				upstreamRes, err := client.Get(upstream.URL)
+				if err != nil {
+					return err
+				}
+				upstreamRes.Body.Close()
+
+				return ctx.Response.NoContent()
+			})
+		})
+
+		AfterEach(func() {
+			upstream.Close()
+		})
+
+		It("should echo the ID in the response", func() {
+			req := httptest.NewRequest("GET", "/proxy", nil)
+			req.Header.Set("X-Request-ID", "client-id")
+			res := serve(srv, req)
+
+			Expect(res.Header().Get("X-Request-ID")).To(HavePrefix("client-id, "))
+		})
+
+		It("should echo the ID set by middlewares", func() {
+			srv.SetRequestIDOptions(srvPkg.RequestIDOptions{ResponseHeader: "X-Trace-ID"})
+			srv.Serve("GET", "/renamed", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				ctx.SetRequestID("new-id")
+				if err := ctx.Response.NoContent(); err != nil {
+					return err
+				}
+
+				// The response is written, the header cannot be changed anymore.
+				ctx.SetRequestID("late-id")
+				return nil
+			})
+			res := serve(srv, httptest.NewRequest("GET", "/renamed", nil))
+
+			Expect(res.Header().Get("X-Trace-ID")).To(Equal("new-id"))
+		})
+
+		It("should echo the ID in the configured header", func() {
+			srv.SetRequestIDOptions(srvPkg.RequestIDOptions{ResponseHeader: "X-Trace-ID"})
+			res := serve(srv, httptest.NewRequest("GET", "/proxy", nil))
+
+			Expect(res.Header().Get("X-Trace-ID")).NotTo(BeEmpty())
+			Expect(res.Header().Get("X-Request-ID")).To(BeEmpty())
+		})
+
+		It("should add the ID and trace context to outgoing requests", func() {
+			srv.SetTracer(srvPkg.NewTracer(srvPkg.NewWriterSpanExporter(&bytes.Buffer{})))
+			res := serve(srv, httptest.NewRequest("GET", "/proxy", nil))
+
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(received.Get("X-Request-ID")).To(Equal(res.Header().Get("X-Request-ID")))
+			Expect(received.Get("traceparent")).To(Equal(res.Header().Get("traceparent")))
+		})
+
+		It("should use the configured header for incoming, echoed and outgoing IDs", func() {
+			srv.SetRequestIDOptions(srvPkg.RequestIDOptions{Headers: []string{"X-Correlation-ID"}})
+			req := httptest.NewRequest("GET", "/proxy", nil)
+			req.Header.Set("X-Correlation-ID", "client-id")
+			res := serve(srv, req)
+
+			Expect(res.Header().Get("X-Correlation-ID")).To(HavePrefix("client-id, "))
+			Expect(received.Get("X-Correlation-ID")).To(Equal(res.Header().Get("X-Correlation-ID")))
+			Expect(received.Get("X-Request-ID")).To(BeEmpty())
+		})
+
+		It("should propagate the ID carried by the request context", func() {
+			client := &http.Client{Transport: srvPkg.NewTransport(nil, nil)}
+			req, err := http.NewRequest("GET", upstream.URL, nil)
+			Expect(err).To(BeNil())
+
+			upstreamRes, err := client.Do(req.WithContext(srvPkg.ContextWithRequestID(context.Background(), "outgoing-id")))
+			Expect(err).To(BeNil())
+			upstreamRes.Body.Close()
+
+			Expect(received.Get("X-Request-ID")).To(Equal("outgoing-id"))
+			Expect(received.Get("traceparent")).To(BeEmpty())
+		})
+	})
+})
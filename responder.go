@@ -1,18 +1,190 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/giantswarm/request-context"
+	"github.com/juju/errgo"
 )
 
 type Response struct {
-	w http.ResponseWriter
+	w   http.ResponseWriter
+	req *http.Request
+
+	requestCtx requestcontext.Ctx
+	etagMode   ETagMode
+	templates  *templateSet
+}
+
+// committer is implemented by response writers tracking whether the response
+// was already sent, like the one wrapping every request of the server.
+type committer interface {
+	Written() bool
+	Status() int
+}
+
+// Written returns true if the status code or parts of the body were already
+// sent. A response can only be written once, further calls to the writing
+// methods of Response return ResponseWrittenError.
+func (response *Response) Written() bool {
+	if c, ok := response.w.(committer); ok {
+		return c.Written()
+	}
+
+	return false
+}
+
+// Status returns the status code sent, or 0 if the response was not written
+// yet.
+func (response *Response) Status() int {
+	if c, ok := response.w.(committer); ok {
+		return c.Status()
+	}
+
+	return 0
+}
+
+// SetETagMode overwrites the ETag mode of the server for this response.
+func (response *Response) SetETagMode(mode ETagMode) {
+	response.etagMode = mode
+}
+
+// SetLastModified sets the `Last-Modified` header. Responses written by Json
+// then answer requests carrying a matching `If-Modified-Since` header with
+// http.StatusNotModified.
+func (response *Response) SetLastModified(t time.Time) {
+	response.w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
 }
 
+// CheckPreconditions evaluates the `If-Match` and `If-Unmodified-Since`
+// request headers against the current ETag and modification time of the
+// resource a middleware is about to change. An empty etag means the resource
+// does not exist, a zero lastModified skips the time based check. If a
+// precondition fails, http.StatusPreconditionFailed is sent and false is
+// returned, so the middleware can stop processing.
+func (response *Response) CheckPreconditions(etag string, lastModified time.Time) bool {
+	if response.Written() {
+		return false
+	}
+
+	if im := response.req.Header.Get("If-Match"); im != "" {
+		if !etagMatch(im, etag, false) {
+			response.w.WriteHeader(http.StatusPreconditionFailed)
+			return false
+		}
+
+		return true
+	}
+
+	ius := response.req.Header.Get("If-Unmodified-Since")
+	if ius == "" || lastModified.IsZero() {
+		return true
+	}
+	since, err := http.ParseTime(ius)
+	if err != nil {
+		return true
+	}
+	if lastModified.Truncate(time.Second).After(since) {
+		response.w.WriteHeader(http.StatusPreconditionFailed)
+		return false
+	}
+
+	return true
+}
+
+// Json writes result JSON encoded. If ETags are enabled, an ETag is computed
+// over the encoded body and conditional requests are answered with
+// http.StatusNotModified.
 func (response *Response) Json(result interface{}, code int) error {
+	if response.Written() {
+		return errgo.Mask(ResponseWrittenError, errgo.Any)
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(result); err != nil {
+		return errgo.Mask(err)
+	}
+
 	response.w.Header().Add("Content-Type", "application/json")
-	response.w.WriteHeader(code)
-	return json.NewEncoder(response.w).Encode(result)
+	return response.writeConditional(body.Bytes(), code)
+}
+
+// HTML renders the page with the given name from the templates loaded using
+// `Server.LoadTemplates`. The ID of the current request is available to the
+// templates by calling `requestID`. If ETags are enabled, conditional requests
+// are handled like for Json.
+func (response *Response) HTML(name string, data interface{}, code int) error {
+	if response.Written() {
+		return errgo.Mask(ResponseWrittenError, errgo.Any)
+	}
+	if response.templates == nil {
+		return errgo.New("no templates loaded")
+	}
+
+	var body bytes.Buffer
+	if err := response.templates.render(&body, name, data, response.requestID()); err != nil {
+		return errgo.Mask(err)
+	}
+
+	response.w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return response.writeConditional(body.Bytes(), code)
+}
+
+// File sends the file at the given path as download, see Stream.
+func (response *Response) File(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	if info.IsDir() {
+		return errgo.Newf("%s is a directory", path)
+	}
+
+	return response.Stream(f, filepath.Base(path), info.ModTime())
+}
+
+// Stream sends content as download with the given file name. The content
+// type is detected based on the extension of name or the content itself.
+// Range and If-Range requests are supported to resume downloads, as well as
+// conditional requests based on modtime and, if enabled, ETags.
+func (response *Response) Stream(content io.ReadSeeker, name string, modtime time.Time) error {
+	if response.Written() {
+		return errgo.Mask(ResponseWrittenError, errgo.Any)
+	}
+
+	header := response.w.Header()
+	if name != "" {
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+
+	if response.etagMode != ETagNone && header.Get("ETag") == "" {
+		size, err := content.Seek(0, io.SeekEnd)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return errgo.Mask(err)
+		}
+
+		header.Set("ETag", fileETag(size, modtime, response.etagMode))
+	}
+
+	http.ServeContent(response.w, response.req, name, modtime, content)
+
+	return nil
 }
 
 func (response *Response) Error(message string, code int) error {
@@ -20,12 +192,20 @@ func (response *Response) Error(message string, code int) error {
 }
 
 func (response *Response) PlainText(content string, code int) error {
+	if response.Written() {
+		return errgo.Mask(ResponseWrittenError, errgo.Any)
+	}
+
 	response.w.WriteHeader(code)
 	response.w.Write([]byte(content))
 	return nil
 }
 
 func (response *Response) NoContent() error {
+	if response.Written() {
+		return errgo.Mask(ResponseWrittenError, errgo.Any)
+	}
+
 	response.w.WriteHeader(http.StatusNoContent)
 	return nil
 }
@@ -33,6 +213,10 @@ func (response *Response) NoContent() error {
 // Unauthorized sends the http.StatusUnauthorized status code.
 // Use this to signal the requestee that the authentication failed.
 func (response *Response) Unauthorized(scheme string) error {
+	if response.Written() {
+		return errgo.Mask(ResponseWrittenError, errgo.Any)
+	}
+
 	response.w.Header().Add("WWW-Authenticate", scheme)
 	response.w.WriteHeader(http.StatusUnauthorized)
 	return nil
@@ -41,12 +225,57 @@ func (response *Response) Unauthorized(scheme string) error {
 // Forbidden sends the http.StatusForbidden status.
 // Use it to signal that the requestee has no access to the given resource (but auth itself worked).
 func (response *Response) Forbidden() error {
+	if response.Written() {
+		return errgo.Mask(ResponseWrittenError, errgo.Any)
+	}
+
 	response.w.WriteHeader(http.StatusForbidden)
 	return nil
 }
 
 func (response *Response) Redirect(location string, code int) error {
+	if response.Written() {
+		return errgo.Mask(ResponseWrittenError, errgo.Any)
+	}
+
 	response.w.Header().Set("Location", location)
 	response.w.WriteHeader(code)
 	return nil
 }
+
+//------------------------------------------------------------------------------
+// private
+
+func (response *Response) requestID() string {
+	id, _ := response.requestCtx[RequestIDKey].(string)
+	return id
+}
+
+// writeConditional writes body with the given status code. Successful
+// responses get an ETag, if enabled, and are replaced by
+// http.StatusNotModified in case the client already has the current version.
+func (response *Response) writeConditional(body []byte, code int) error {
+	header := response.w.Header()
+
+	if code == http.StatusOK {
+		etag := ""
+		if response.etagMode != ETagNone {
+			etag = bodyETag(body, response.etagMode)
+			header.Set("ETag", etag)
+		}
+
+		if notModified(response.req, etag, header.Get("Last-Modified")) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			response.w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+
+	response.w.WriteHeader(code)
+	if _, err := response.w.Write(body); err != nil {
+		return errgo.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package server_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing/fstest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	srvPkg "github.com/giantswarm/middleware-server"
+)
+
+func serve(srv *srvPkg.Server, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.Router.ServeHTTP(rec, req)
+	return rec
+}
+
+var _ = Describe("Response", func() {
+	var (
+		srv *srvPkg.Server
+	)
+
+	BeforeEach(func() {
+		srv = srvPkg.NewServer("", "")
+		srv.Serve("GET", "/json", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+			return ctx.Response.Json(map[string]string{"hello": "world"}, http.StatusOK)
+		})
+		srv.Serve("PUT", "/json", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+			if !ctx.Response.CheckPreconditions(`"current"`, time.Time{}) {
+				return nil
+			}
+			return ctx.Response.NoContent()
+		})
+	})
+
+	Describe("ETags", func() {
+		Context("ETags disabled", func() {
+			It("should not send an ETag", func() {
+				rec := serve(srv, httptest.NewRequest("GET", "/json", nil))
+
+				Expect(rec.Code).To(Equal(http.StatusOK))
+				Expect(rec.Header().Get("ETag")).To(BeEmpty())
+			})
+		})
+
+		Context("strong ETags enabled", func() {
+			var etag string
+
+			BeforeEach(func() {
+				srv.SetETagMode(srvPkg.ETagStrong)
+
+				rec := serve(srv, httptest.NewRequest("GET", "/json", nil))
+				etag = rec.Header().Get("ETag")
+
+				Expect(rec.Code).To(Equal(http.StatusOK))
+				Expect(rec.Body.String()).To(Equal("{\"hello\":\"world\"}\n"))
+			})
+
+			It("should send a strong ETag", func() {
+				Expect(etag).To(HavePrefix(`"`))
+			})
+
+			It("should respond with 304 for a matching If-None-Match header", func() {
+				req := httptest.NewRequest("GET", "/json", nil)
+				req.Header.Set("If-None-Match", `"foo", `+etag)
+				rec := serve(srv, req)
+
+				Expect(rec.Code).To(Equal(http.StatusNotModified))
+				Expect(rec.Body.Len()).To(Equal(0))
+			})
+
+			It("should respond with 200 for an outdated If-None-Match header", func() {
+				req := httptest.NewRequest("GET", "/json", nil)
+				req.Header.Set("If-None-Match", `"outdated"`)
+				rec := serve(srv, req)
+
+				Expect(rec.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("weak ETags enabled", func() {
+			It("should send a weak ETag", func() {
+				srv.SetETagMode(srvPkg.ETagWeak)
+				rec := serve(srv, httptest.NewRequest("GET", "/json", nil))
+
+				Expect(rec.Header().Get("ETag")).To(HavePrefix(`W/"`))
+			})
+		})
+	})
+
+	Describe("preconditions", func() {
+		It("should respond with 412 for a mismatching If-Match header", func() {
+			req := httptest.NewRequest("PUT", "/json", nil)
+			req.Header.Set("If-Match", `"outdated"`)
+			rec := serve(srv, req)
+
+			Expect(rec.Code).To(Equal(http.StatusPreconditionFailed))
+		})
+
+		It("should process the request for a matching If-Match header", func() {
+			req := httptest.NewRequest("PUT", "/json", nil)
+			req.Header.Set("If-Match", `"current"`)
+			rec := serve(srv, req)
+
+			Expect(rec.Code).To(Equal(http.StatusNoContent))
+		})
+
+		It("should never match weak ETags", func() {
+			req := httptest.NewRequest("PUT", "/json", nil)
+			req.Header.Set("If-Match", `W/"current"`)
+			rec := serve(srv, req)
+
+			Expect(rec.Code).To(Equal(http.StatusPreconditionFailed))
+		})
+	})
+
+	Describe("static files", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "middleware-server")
+			Expect(err).To(BeNil())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "test.txt"), []byte("hello world"), 0644)).To(BeNil())
+
+			srv.SetETagMode(srvPkg.ETagStrong)
+			srv.ServeStatic("/public/", dir)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should answer conditional requests with 304", func() {
+			rec := serve(srv, httptest.NewRequest("GET", "/public/test.txt", nil))
+			etag := rec.Header().Get("ETag")
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(etag).NotTo(BeEmpty())
+
+			req := httptest.NewRequest("GET", "/public/test.txt", nil)
+			req.Header.Set("If-None-Match", etag)
+			rec = serve(srv, req)
+
+			Expect(rec.Code).To(Equal(http.StatusNotModified))
+		})
+	})
+
+	Describe("HTML templates", func() {
+		var (
+			rec *httptest.ResponseRecorder
+			err error
+		)
+
+		BeforeEach(func() {
+			srv.Serve("GET", "/html/{page}", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				ctx.SetRequestID("test-id")
+				return ctx.Response.HTML(ctx.MuxVars["page"], "world", http.StatusOK)
+			})
+		})
+
+		Context("templates using a layout and partials", func() {
+			BeforeEach(func() {
+				err = srv.LoadTemplates(fstest.MapFS{
+					"layouts/main.html":   {Data: []byte(`{{define "layout"}}<main>{{template "content" .}}</main>{{end}}`)},
+					"partials/greet.html": {Data: []byte(`{{define "greet"}}hello {{.}}{{end}}`)},
+					"index.html":          {Data: []byte(`{{define "content"}}{{template "greet" .}} ({{requestID}}){{end}}`)},
+				}, srvPkg.TemplateOptions{})
+
+				rec = serve(srv, httptest.NewRequest("GET", "/html/index", nil))
+			})
+
+			It("should load the templates", func() {
+				Expect(err).To(BeNil())
+			})
+
+			It("should render the page within the layout", func() {
+				Expect(rec.Code).To(Equal(http.StatusOK))
+				Expect(rec.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+				Expect(rec.Body.String()).To(Equal("<main>hello world (test-id)</main>"))
+			})
+		})
+
+		Context("templates without a layout", func() {
+			BeforeEach(func() {
+				err = srv.LoadTemplates(fstest.MapFS{
+					"index.html": {Data: []byte(`hello <b>{{.}}</b>`)},
+				}, srvPkg.TemplateOptions{})
+
+				rec = serve(srv, httptest.NewRequest("GET", "/html/index", nil))
+			})
+
+			It("should render the page itself", func() {
+				Expect(err).To(BeNil())
+				Expect(rec.Body.String()).To(Equal("hello <b>world</b>"))
+			})
+		})
+
+		Context("unknown page", func() {
+			It("should respond with an error", func() {
+				err = srv.LoadTemplates(fstest.MapFS{}, srvPkg.TemplateOptions{})
+				rec = serve(srv, httptest.NewRequest("GET", "/html/unknown", nil))
+
+				Expect(err).To(BeNil())
+				Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Describe("downloads", func() {
+		var (
+			entry *srvPkg.AccessEntry
+			dir   string
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "middleware-server")
+			Expect(err).To(BeNil())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "report.csv"), []byte("a,b\n1,2\n"), 0644)).To(BeNil())
+
+			srv.SetPostHTTPHandler(func(e *srvPkg.AccessEntry) {
+				entry = e
+			})
+			srv.Serve("GET", "/stream", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				return ctx.Response.Stream(strings.NewReader("hello world"), "hello.txt", time.Now())
+			})
+			srv.Serve("GET", "/file", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				return ctx.Response.File(filepath.Join(dir, "report.csv"))
+			})
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should send the complete content", func() {
+			rec := serve(srv, httptest.NewRequest("GET", "/stream", nil))
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(Equal("hello world"))
+			Expect(rec.Header().Get("Content-Type")).To(HavePrefix("text/plain"))
+			Expect(rec.Header().Get("Content-Disposition")).To(Equal(`attachment; filename=hello.txt`))
+			Expect(entry.Partial()).To(BeFalse())
+		})
+
+		It("should send the requested range", func() {
+			req := httptest.NewRequest("GET", "/stream", nil)
+			req.Header.Set("Range", "bytes=6-")
+			rec := serve(srv, req)
+
+			Expect(rec.Code).To(Equal(http.StatusPartialContent))
+			Expect(rec.Body.String()).To(Equal("world"))
+			Expect(entry.Partial()).To(BeTrue())
+			Expect(entry.ContentRange()).To(Equal("bytes 6-10/11"))
+			Expect(entry.Size()).To(Equal(int64(5)))
+		})
+
+		It("should send files", func() {
+			rec := serve(srv, httptest.NewRequest("GET", "/file", nil))
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(Equal("a,b\n1,2\n"))
+			Expect(rec.Header().Get("Content-Disposition")).To(Equal(`attachment; filename=report.csv`))
+		})
+	})
+})
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -13,7 +15,6 @@ import (
 	"github.com/giantswarm/request-context"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
-	"github.com/juju/errgo"
 )
 
 const (
@@ -48,6 +49,13 @@ type Context struct {
 	// CtxConstructor, if set in the server.
 	App     interface{}
 	Request requestcontext.Ctx
+
+	span            *Span
+	entry           *AccessEntry
+	forwarded       Forwarded
+	serverLogger    Logger
+	logger          Logger
+	requestIDHeader string
 }
 
 // RequestID returns ID for the current request.
@@ -63,19 +71,93 @@ func (c *Context) RequestID() string {
 }
 
 // SetRequestID overwrites the request ID of the current request
-// with the given ID.
+// with the given ID. Messages logged using Logger afterwards carry the new ID.
+// Unless the response was already written, the new ID is echoed instead, see
+// `RequestIDOptions.ResponseHeader`.
 func (c *Context) SetRequestID(ID string) {
 	c.Request[RequestIDKey] = ID
+	c.logger = requestLogger(c.serverLogger, ID, c.Response.req)
+
+	if !c.Response.Written() {
+		c.Response.w.Header().Set(c.requestIDHeader, ID)
+	}
+}
+
+// ClientIP returns the IP of the client. If the request passed trusted
+// proxies, this is the IP reported by them, see `Server.SetTrustedProxies`.
+func (c *Context) ClientIP() net.IP {
+	return c.forwarded.ClientIP
+}
+
+// Scheme returns the scheme requested by the client, "http" or "https". If
+// the request passed trusted proxies, this is the scheme reported by them.
+func (c *Context) Scheme() string {
+	return c.forwarded.Scheme
+}
+
+// Host returns the host requested by the client. If the request passed
+// trusted proxies, this is the host reported by them.
+func (c *Context) Host() string {
+	return c.forwarded.Host
+}
+
+// SetPrincipal records the authenticated principal of the request, e.g. the
+// user name, so access reporters can log it.
+func (c *Context) SetPrincipal(principal string) {
+	if c.entry != nil {
+		c.entry.setPrincipal(principal)
+	}
+}
+
+// Annotate adds a key/value pair to the access entry of the request, so
+// access reporters can log it.
+func (c *Context) Annotate(key, value string) {
+	if c.entry != nil {
+		c.entry.annotate(key, value)
+	}
+}
+
+// Logger returns the logger of the server, adding the request ID and route
+// name to every message.
+func (c *Context) Logger() Logger {
+	return c.logger
+}
+
+// Span returns the server span of the current request, or nil if tracing is
+// disabled. All methods of Span can safely be called on nil.
+func (c *Context) Span() *Span {
+	return c.span
+}
+
+// StartSpan starts a child span of the server span of the current request.
+// The caller must call Finish on the returned span. Returns nil if tracing is
+// disabled.
+func (c *Context) StartSpan(name string) *Span {
+	return c.span.StartChild(name)
 }
 
 type Server struct {
 	// The address to listen on.
-	addr                string
-	logLevel            string
-	logColor            bool
-	Logger              requestcontext.Logger
-	listener            net.Listener
-	extendAccessLogging bool
+	addr            string
+	logLevel        string
+	logColor        bool
+	Logger          Logger
+	loggers         map[string]Leveler
+	loggersMutex    sync.Mutex
+	logLevelMutex   sync.Mutex
+	debugToggle     map[string]string
+	listener        net.Listener
+	accessReporter  AccessReporterFactory
+	accessReporters []AccessReporterFactory
+	etagMode        ETagMode
+	templates       *templateSet
+	metrics         *Metrics
+	tracer          *Tracer
+	debugLogging    *debugLogging
+	accessLogPolicy *accessLogPolicy
+	trustedProxies  *TrustedProxies
+	initMutex       sync.Mutex
+	initializers    []*initializerState
 
 	preHTTPHandler  AccessReporter
 	postHTTPHandler AccessReporter
@@ -91,7 +173,8 @@ type Server struct {
 	osExitDelay        time.Duration
 	osExitCode         int
 
-	IDFactory func() string
+	IDFactory        func() string
+	requestIDOptions RequestIDOptions
 }
 
 func NewServer(host, port string) *Server {
@@ -100,13 +183,16 @@ func NewServer(host, port string) *Server {
 	router.KeepContext = true
 
 	s := &Server{
-		addr:      host + ":" + port,
-		Router:    router,
-		IDFactory: NewIDFactory(),
-		logColor:  true,
+		addr:           host + ":" + port,
+		Router:         router,
+		IDFactory:      NewIDFactory(),
+		logColor:       true,
+		accessReporter: DefaultAccessReporter,
+		loggers:        map[string]Leveler{},
 	}
 
-	s.SetLogger(requestcontext.MustGetLogger(requestcontext.LoggerConfig{Name: "server", Color: s.logColor}))
+	s.SetLogger(NewGoLoggingLogger(requestcontext.LoggerConfig{Name: ServerLoggerName, Color: s.logColor}))
+	s.SetRequestIDOptions(RequestIDOptions{})
 	s.SetCloseListenerDelay(DefaultCloseListenerDelay)
 	s.SetOsExitDelay(DefaultOsExitDelay)
 	s.SetOsExitCode(DefaultOsExitCode)
@@ -124,9 +210,10 @@ func (s *Server) Serve(method, urlPath string, middlewares ...Middleware) {
 }
 
 // ServeStatis registers a middleware that serves files from the filesystem.
+// If enabled using SetETagMode, files are served with ETags.
 // Example: s.ServeStatic("/v1/public", "./public_html/v1/")
 func (s *Server) ServeStatic(urlPath, fsPath string) {
-	handler := http.StripPrefix(urlPath, http.FileServer(http.Dir(fsPath)))
+	handler := http.StripPrefix(urlPath, s.newStaticHandler(fsPath))
 	s.Router.Methods("GET").PathPrefix(urlPath).Handler(handler)
 }
 
@@ -140,7 +227,7 @@ func (s *Server) ServeNotFound(middlewares ...Middleware) {
 
 // ExtendAccessLogging turns on the usage of ExtendedAccessLogger
 func (s *Server) ExtendAccessLogging() {
-	s.extendAccessLogging = true
+	s.SetAccessReporter(ExtendedAccessReporter)
 }
 
 func (s *Server) RegisterRoutes(mux *http.ServeMux, prefix string) {
@@ -176,11 +263,13 @@ func (s *Server) Listen() {
 				// We ignore the error "use of closed network connection", because it is
 				// caused by us when shutting down the server.
 			} else {
-				s.Logger.Error(nil, "%#v", errgo.Mask(err))
+				s.Logger.Error("serving failed", "error", err)
 			}
 		}
 	}()
 
+	go s.runInitializers()
+
 	s.listenSignals()
 }
 
@@ -190,12 +279,19 @@ func (s *Server) listenSignals() {
 	// if we're not ready to receive when the signal is sent.
 	c := make(chan os.Signal, 2)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
+	if len(debugSignals) > 0 {
+		signal.Notify(c, debugSignals...)
+	}
 
 	// Block until a signal is received.
 	for {
 		select {
 		case sig := <-c:
-			s.Logger.Info(nil, "server received signal %s", sig)
+			s.Logger.Info("server received signal", "signal", sig.String())
+			if isDebugSignal(sig) {
+				s.ToggleDebugLogging("signal " + sig.String())
+				continue
+			}
 			go s.Close()
 		}
 	}
@@ -203,7 +299,7 @@ func (s *Server) listenSignals() {
 
 // Closing returns true when the server is shutting down, false otherwise.
 func (s *Server) Closing() bool {
-	return s.signalCounter > 0
+	return atomic.LoadUint32(&s.signalCounter) > 0
 }
 
 func (s *Server) Close() {
@@ -212,18 +308,18 @@ func (s *Server) Close() {
 		s.ExitProcess()
 	}
 
-	s.Logger.Info(nil, "closing tcp listener in %s", s.closeListenerDelay.String())
+	s.Logger.Info("closing tcp listener", "delay", s.closeListenerDelay.String())
 	time.Sleep(s.closeListenerDelay)
 	s.listener.Close()
 
-	s.Logger.Info(nil, "shutting down server in %s", s.osExitDelay.String())
+	s.Logger.Info("shutting down server", "delay", s.osExitDelay.String())
 	time.Sleep(s.osExitDelay)
 
 	s.ExitProcess()
 }
 
 func (s *Server) ExitProcess() {
-	s.Logger.Info(nil, "shutting down server with exit code %d", s.osExitCode)
+	s.Logger.Info("exiting process", "exit_code", s.osExitCode)
 	os.Exit(s.osExitCode)
 }
 
@@ -235,33 +331,47 @@ func (s *Server) ExitProcess() {
 func (s *Server) NewMiddlewareHandler(middlewares []Middleware) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 		// prepare request
-		requestID := req.Header.Get(RequestIDHeader)
-
-		// TODO: This is just for backward compatibility. Currently clients are
-		// sending both, client and request ID's. We just changed our concept and
-		// pushed client changes too fast, so we need to support them for a while
-		// to not be confused by our received data.
-		clientID := req.Header.Get("X-Client-ID")
-		if clientID != "" && requestID != "" {
-			requestID = clientID
-		}
-
-		if requestID == "" {
-			requestID = s.IDFactory()
-		} else {
-			requestID += ", " + s.IDFactory()
-		}
+		idOptions := s.requestIDOptions.withDefaults()
+		requestID := s.requestID(req, idOptions)
+		req = req.WithContext(ContextWithRequestID(req.Context(), requestID))
+		res.Header().Set(idOptions.ResponseHeader, requestID)
 		requestCtx := requestcontext.Ctx{
 			RequestIDKey: requestID,
 		}
+		logger := requestLogger(s.Logger, requestID, req)
 
 		// create handler that actually processes the middlewares
 		middlewareHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			forwarded := s.trustedProxies.Resolve(req)
+			s.trustedProxies.stripUntrusted(req)
+
+			entry := accessEntryFromRequest(req)
+			if entry != nil {
+				entry.clientIP = forwarded.ClientIP
+
+				if s.debugLogging != nil && s.debugLogging.enabledFor(req, entry.clientIP) {
+					s.debugLogging.start(entry, req)
+				}
+			}
+
 			ctx := &Context{
-				MuxVars: mux.Vars(req),
-				Request: requestCtx,
+				MuxVars:   mux.Vars(req),
+				Request:   requestCtx,
+				span:      SpanFromContext(req.Context()),
+				entry:     entry,
+				forwarded: forwarded,
+
+				serverLogger: s.Logger,
+				logger:       logger,
+
+				requestIDHeader: idOptions.ResponseHeader,
+
 				Response: Response{
-					w: res,
+					w:          res,
+					req:        req,
+					requestCtx: requestCtx,
+					etagMode:   s.etagMode,
+					templates:  s.templates,
 				},
 			}
 
@@ -278,7 +388,14 @@ func (s *Server) NewMiddlewareHandler(middlewares []Middleware) http.Handler {
 
 				// End the request with an error and stop calling further middlewares.
 				if err := middleware(res, req, ctx); err != nil {
-					s.Logger.Error(requestCtx, "%s %s %#v", req.Method, req.URL, errgo.Mask(err))
+					ctx.logger.Error("middleware failed", "method", req.Method, "url", req.URL.String(), "error", err)
+
+					// The middleware might have written the response before returning
+					// the error. Writing it again would only garble the response.
+					if ctx.Response.Written() {
+						ctx.logger.Warn("response already written, dropping error response", "method", req.Method, "url", req.URL.String(), "status", ctx.Response.Status())
+						break
+					}
 
 					ctx.Response.Error(err.Error(), http.StatusInternalServerError)
 					break
@@ -291,9 +408,56 @@ func (s *Server) NewMiddlewareHandler(middlewares []Middleware) http.Handler {
 		})
 
 		// do access-logging by wrapping the middleware handler
-		reporter := DefaultAccessReporter(requestCtx, s.Logger)
-		if s.extendAccessLogging {
-			reporter = ExtendedAccessReporter(requestCtx, s.Logger)
+		var reporters []AccessReporter
+		if s.accessReporter != nil {
+			reporter := s.accessReporter(requestCtx, logger)
+			if s.accessLogPolicy != nil {
+				reporter = s.accessLogPolicy.wrap(reporter, logger)
+			}
+			reporters = append(reporters, reporter)
+		}
+		for _, factory := range s.accessReporters {
+			reporters = append(reporters, factory(requestCtx, logger))
+		}
+		reporter := func(entry *AccessEntry) {
+			for _, r := range reporters {
+				r(entry)
+			}
+		}
+
+		// start the server span, if enabled, and finish it as part of the access
+		// reporting
+		if s.tracer != nil {
+			span := s.tracer.startServerSpan(req, func(err error) {
+				logger.Error("exporting span failed", "error", err)
+			})
+			span.SetAttribute("request.id", requestID)
+			req = req.WithContext(ContextWithSpan(req.Context(), span))
+			res.Header().Set(TraceParentHeader, span.SpanContext().TraceParent())
+			if state := span.SpanContext().TraceState; state != "" {
+				res.Header().Set(TraceStateHeader, state)
+			}
+
+			tracedReporter := reporter
+			reporter = func(entry *AccessEntry) {
+				span.SetAttribute("http.status_code", strconv.Itoa(entry.StatusCode()))
+				if entry.StatusCode() >= http.StatusInternalServerError {
+					span.SetError(http.StatusText(entry.StatusCode()))
+				}
+				span.Finish()
+
+				tracedReporter(entry)
+			}
+		}
+
+		// record metrics, if enabled, as part of the access reporting
+		if s.metrics != nil {
+			defer s.metrics.track(req)()
+			accessReporter := reporter
+			reporter = func(entry *AccessEntry) {
+				s.metrics.report(entry)
+				accessReporter(entry)
+			}
 		}
 
 		handler := NewLogAccessHandler(
@@ -307,3 +471,12 @@ func (s *Server) NewMiddlewareHandler(middlewares []Middleware) http.Handler {
 		handler.ServeHTTP(res, req)
 	})
 }
+
+//------------------------------------------------------------------------------
+// private
+
+// requestLogger returns logger adding the given request ID and the route name
+// of req to every message.
+func requestLogger(logger Logger, requestID string, req *http.Request) Logger {
+	return logger.With("request_id", requestID, "route", currentRouteName(req))
+}
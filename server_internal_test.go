@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("closing server", func() {
+	var srv *Server
+
+	ginkgo.BeforeEach(func() {
+		srv = NewServer("", "")
+		srv.SetAccessReporter(nil)
+		srv.Serve("GET", "/livez", NewLivenessMiddleware(nil))
+		srv.Serve("GET", "/readyz", NewReadinessMiddleware(srv, nil))
+	})
+
+	get := func(url string) int {
+		rec := httptest.NewRecorder()
+		srv.Router.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		return rec.Code
+	}
+
+	ginkgo.It("should fail readiness probes while closing", func() {
+		Expect(get("/readyz")).To(Equal(http.StatusOK))
+
+		// Close exits the process, so only record the signal it would count.
+		atomic.AddUint32(&srv.signalCounter, 1)
+
+		Expect(srv.Closing()).To(BeTrue())
+		Expect(get("/readyz")).To(Equal(http.StatusServiceUnavailable))
+		Expect(get("/livez")).To(Equal(http.StatusOK))
+	})
+})
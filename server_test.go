@@ -7,7 +7,6 @@ import (
 	"github.com/giantswarm/middleware-server/test"
 
 	srvPkg "github.com/giantswarm/middleware-server"
-	log "github.com/op/go-logging"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -21,7 +20,7 @@ func TestServer(t *testing.T) {
 
 // Define testing middlewares v1.
 type V1 struct {
-	Logger *log.Logger
+	Logger srvPkg.Logger
 }
 
 func (this *V1) first(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
@@ -39,7 +38,7 @@ type AppContext struct {
 }
 
 type V2 struct {
-	Logger *log.Logger
+	Logger srvPkg.Logger
 }
 
 func (this *V2) first(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
@@ -61,7 +60,7 @@ var _ = Describe("Server", func() {
 		body1  string
 		body2  string
 		srv    *srvPkg.Server
-		logger *log.Logger
+		logger srvPkg.Logger
 	)
 
 	BeforeEach(func() {
@@ -136,4 +135,37 @@ var _ = Describe("Server", func() {
 			})
 		})
 	})
+
+	Context("Middleware returning an error after writing the response", func() {
+		var writeErr error
+
+		BeforeEach(func() {
+			srv.Serve("GET", "/v1/written/", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				ctx.Response.PlainText("hello world", http.StatusOK)
+				writeErr = ctx.Response.PlainText("hello again", http.StatusOK)
+
+				Expect(ctx.Response.Written()).To(BeTrue())
+				Expect(ctx.Response.Status()).To(Equal(http.StatusOK))
+
+				return writeErr
+			})
+
+			// Configure test server router.
+			ts.Config.Handler = srv.Router
+
+			code1, body1, _ = test.NewGetRequest(ts.URL + "/v1/written/")
+		})
+
+		It("Should reject writing the response twice", func() {
+			Expect(srvPkg.IsResponseWritten(writeErr)).To(BeTrue())
+		})
+
+		It("Should keep the status code of the written response", func() {
+			Expect(code1).To(Equal(http.StatusOK))
+		})
+
+		It("Should not write the error to the response", func() {
+			Expect(body1).To(Equal("hello world"))
+		})
+	})
 })
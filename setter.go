@@ -1,9 +1,10 @@
 package server
 
 import (
+	"io"
 	"time"
 
-	"github.com/giantswarm/request-context"
+	"github.com/juju/errgo"
 )
 
 func (s *Server) SetPreHTTPHandler(reporter AccessReporter) {
@@ -14,6 +15,50 @@ func (s *Server) SetPostHTTPHandler(reporter AccessReporter) {
 	s.postHTTPHandler = reporter
 }
 
+// SetAccessReporter sets the factory creating the AccessReporter used to log
+// every request, e.g. JSONAccessReporter. Defaults to DefaultAccessReporter.
+// Setting nil disables access logging.
+func (s *Server) SetAccessReporter(factory AccessReporterFactory) {
+	s.accessReporter = factory
+}
+
+// AddAccessReporter registers an additional reporter, e.g. for auditing or
+// analytics. Reporters run in order after the one set using
+// SetAccessReporter. Use NewAsyncAccessReporter for slow sinks.
+func (s *Server) AddAccessReporter(factory AccessReporterFactory) {
+	s.accessReporters = append(s.accessReporters, factory)
+}
+
+// SetAccessLogFormat sets an access logger writing one line per request to
+// w, formatted according to the given template, e.g. CombinedLogFormat. If w
+// is nil, the lines are logged using the logger of the server. See
+// TemplateAccessReporter for the supported directives.
+func (s *Server) SetAccessLogFormat(format string, w io.Writer) error {
+	factory, err := TemplateAccessReporter(format, w)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	s.SetAccessReporter(factory)
+
+	return nil
+}
+
+// SetMetrics enables recording request metrics for all routes registered
+// using Serve. Use NewMetricsMiddleware to expose them.
+func (s *Server) SetMetrics(m *Metrics) {
+	s.metrics = m
+}
+
+// SetTracer enables tracing. A server span named after the route is started
+// for every request registered using Serve, continuing the trace given by the
+// `traceparent` header. Middlewares can start child spans using
+// `Context.StartSpan`. Export errors of spans started by the server and their
+// children are logged. Setting nil disables tracing.
+func (s *Server) SetTracer(t *Tracer) {
+	s.tracer = t
+}
+
 // SetAppContext sets the CtxConstructor object, that is called for every
 // request to provide the initial `Context.App` value, which is available to
 // every middleware.
@@ -21,8 +66,22 @@ func (s *Server) SetAppContext(ctxConstructor CtxConstructor) {
 	s.ctxConstructor = ctxConstructor
 }
 
+// SetETagMode enables ETags for responses written by `Response.Json` and files
+// served by `ServeStatic`. Conditional requests are answered with
+// http.StatusNotModified then. Defaults to ETagNone.
+func (s *Server) SetETagMode(mode ETagMode) {
+	s.etagMode = mode
+}
+
+// SetLogLevel sets the level of the logger of the server, e.g. "INFO", if it
+// implements Leveler. Use ChangeLogLevel to change it at runtime.
 func (s *Server) SetLogLevel(level string) {
 	s.logLevel = level
+	if leveler, ok := s.Logger.(Leveler); ok {
+		if err := leveler.SetLevel(level); err != nil {
+			s.Logger.Error("setting log level failed", "error", err)
+		}
+	}
 }
 
 func (s *Server) SetLogColor(color bool) {
@@ -30,8 +89,10 @@ func (s *Server) SetLogColor(color bool) {
 }
 
 // SetLogger sets the logger object to which the server logs every request.
-func (s *Server) SetLogger(logger requestcontext.Logger) {
+// It is registered as ServerLoggerName, see RegisterLogger.
+func (s *Server) SetLogger(logger Logger) {
 	s.Logger = logger
+	s.RegisterLogger(ServerLoggerName, logger)
 }
 
 // SetCloseListenerDelay sets the time to delay closing the TCP listener when
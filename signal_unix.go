@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// debugSignals toggle debug logging, see `Server.ToggleDebugLogging`.
+var debugSignals = []os.Signal{syscall.SIGUSR1}
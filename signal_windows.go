@@ -0,0 +1,8 @@
+package server
+
+import (
+	"os"
+)
+
+// debugSignals is empty, as Windows has no user defined signals.
+var debugSignals = []os.Signal{}
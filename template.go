@@ -0,0 +1,249 @@
+package server
+
+import (
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	DefaultTemplateExtension  = ".html"
+	DefaultTemplateLayoutDir  = "layouts"
+	DefaultTemplatePartialDir = "partials"
+	DefaultTemplateLayout     = "layout"
+)
+
+// TemplateOptions configures how HTML templates are loaded and rendered.
+//
+// Every template file outside of LayoutDir and PartialDir is a page. A page
+// is parsed together with all layouts and partials and is referenced by its
+// path without extension, e.g. "admin/index" for "admin/index.html". In case
+// a template named Layout is defined, rendering a page executes the layout,
+// which is expected to include the page, e.g. using
+// `{{template "content" .}}`. Otherwise the page itself is executed.
+//
+// Templates can call `requestID` to get the ID of the current request.
+type TemplateOptions struct {
+	// Extension of template files. Defaults to DefaultTemplateExtension.
+	Extension string
+
+	// LayoutDir is the directory containing layouts. Defaults to
+	// DefaultTemplateLayoutDir.
+	LayoutDir string
+
+	// PartialDir is the directory containing partials. Defaults to
+	// DefaultTemplatePartialDir.
+	PartialDir string
+
+	// Layout is the name of the template executed to render a page, if
+	// defined. Defaults to DefaultTemplateLayout.
+	Layout string
+
+	// Funcs are additional functions available to all templates.
+	Funcs template.FuncMap
+
+	// Development enables reloading the templates as soon as a file changes.
+	// This should not be used in production.
+	Development bool
+}
+
+// LoadTemplates loads the HTML templates from the given filesystem, so they
+// can be rendered using `Response.HTML`.
+func (s *Server) LoadTemplates(fsys fs.FS, options TemplateOptions) error {
+	set := newTemplateSet(fsys, options)
+	if err := set.load(); err != nil {
+		return errgo.Mask(err)
+	}
+
+	s.templates = set
+
+	return nil
+}
+
+// LoadTemplateDir loads the HTML templates from the given directory.
+// Example: s.LoadTemplateDir("./templates/", TemplateOptions{})
+func (s *Server) LoadTemplateDir(dir string, options TemplateOptions) error {
+	return s.LoadTemplates(os.DirFS(dir), options)
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type templateSet struct {
+	fsys    fs.FS
+	options TemplateOptions
+
+	mutex    sync.RWMutex
+	pages    map[string]*template.Template
+	modified time.Time
+	files    int
+}
+
+func newTemplateSet(fsys fs.FS, options TemplateOptions) *templateSet {
+	if options.Extension == "" {
+		options.Extension = DefaultTemplateExtension
+	}
+	if options.LayoutDir == "" {
+		options.LayoutDir = DefaultTemplateLayoutDir
+	}
+	if options.PartialDir == "" {
+		options.PartialDir = DefaultTemplatePartialDir
+	}
+	if options.Layout == "" {
+		options.Layout = DefaultTemplateLayout
+	}
+
+	return &templateSet{
+		fsys:    fsys,
+		options: options,
+	}
+}
+
+// render executes the page with the given name. The parsed templates are
+// never executed themselves, but cloned, so that `requestID` can be bound to
+// the current request.
+func (ts *templateSet) render(w io.Writer, name string, data interface{}, requestID string) error {
+	if ts.options.Development {
+		if err := ts.reloadIfChanged(); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+
+	ts.mutex.RLock()
+	page, ok := ts.pages[name]
+	ts.mutex.RUnlock()
+	if !ok {
+		return errgo.Newf("template '%s' not found", name)
+	}
+
+	t, err := page.Clone()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	t.Funcs(template.FuncMap{
+		"requestID": func() string { return requestID },
+	})
+
+	entry := name
+	if t.Lookup(ts.options.Layout) != nil {
+		entry = ts.options.Layout
+	}
+
+	if err := t.ExecuteTemplate(w, entry, data); err != nil {
+		return errgo.Mask(err)
+	}
+
+	return nil
+}
+
+func (ts *templateSet) load() error {
+	var shared, pages []string
+	modified, files, err := ts.walk(func(name string) {
+		if ts.isShared(name) {
+			shared = append(shared, name)
+		} else {
+			pages = append(pages, name)
+		}
+	})
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	parsed := map[string]*template.Template{}
+	for _, page := range pages {
+		name := strings.TrimSuffix(page, ts.options.Extension)
+		t := template.New(name).Funcs(template.FuncMap{
+			"requestID": func() string { return "" },
+		})
+		if ts.options.Funcs != nil {
+			t.Funcs(ts.options.Funcs)
+		}
+
+		for _, file := range append(shared, page) {
+			content, err := fs.ReadFile(ts.fsys, file)
+			if err != nil {
+				return errgo.Mask(err)
+			}
+
+			target := t
+			if file != page {
+				target = t.New(file)
+			}
+			if _, err := target.Parse(string(content)); err != nil {
+				return errgo.Mask(err)
+			}
+		}
+
+		parsed[name] = t
+	}
+
+	ts.mutex.Lock()
+	ts.pages = parsed
+	ts.modified = modified
+	ts.files = files
+	ts.mutex.Unlock()
+
+	return nil
+}
+
+func (ts *templateSet) reloadIfChanged() error {
+	modified, files, err := ts.walk(func(string) {})
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	ts.mutex.RLock()
+	changed := modified.After(ts.modified) || files != ts.files
+	ts.mutex.RUnlock()
+
+	if !changed {
+		return nil
+	}
+
+	return ts.load()
+}
+
+// walk calls fn for every template file and returns the latest modification
+// time and the number of files, to detect changes.
+func (ts *templateSet) walk(fn func(name string)) (time.Time, int, error) {
+	var modified time.Time
+	var files int
+
+	err := fs.WalkDir(ts.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(name) != ts.options.Extension {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+		files++
+
+		fn(name)
+
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, 0, errgo.Mask(err)
+	}
+
+	return modified, files, nil
+}
+
+func (ts *templateSet) isShared(name string) bool {
+	return strings.HasPrefix(name, ts.options.LayoutDir+"/") || strings.HasPrefix(name, ts.options.PartialDir+"/")
+}
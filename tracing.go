@@ -0,0 +1,373 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+
+	traceFlagSampled = 0x01
+)
+
+// SpanKind describes the relationship of a span to its parent, following the
+// OpenTelemetry span kinds.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// TraceID identifies a trace as specified by W3C Trace Context.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns false for the all-zero ID.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span as specified by W3C Trace Context.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns false for the all-zero ID.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span propagated across process boundaries
+// using the `traceparent` and `tracestate` headers.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+// IsValid returns true if trace and span ID are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled returns true if the sampled flag is set.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&traceFlagSampled != 0
+}
+
+// TraceParent formats the span context as `traceparent` header value.
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceParent parses a `traceparent` header value, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceParent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, errgo.Newf("invalid traceparent '%s'", value)
+	}
+
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 || version[0] == 0xff {
+		return SpanContext{}, errgo.Newf("invalid traceparent version '%s'", parts[0])
+	}
+	// Future versions may append fields, version 00 must not.
+	if version[0] == 0 && len(parts) != 4 {
+		return SpanContext{}, errgo.Newf("invalid traceparent '%s'", value)
+	}
+
+	var sc SpanContext
+	if err := decodeHexID(sc.TraceID[:], parts[1]); err != nil {
+		return SpanContext{}, errgo.Mask(err)
+	}
+	if err := decodeHexID(sc.SpanID[:], parts[2]); err != nil {
+		return SpanContext{}, errgo.Mask(err)
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, errgo.Newf("invalid traceparent '%s'", value)
+	}
+
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || len(parts[3]) != 2 {
+		return SpanContext{}, errgo.Newf("invalid traceparent flags '%s'", parts[3])
+	}
+	sc.Flags = byte(flags)
+
+	return sc, nil
+}
+
+// SpanExporter receives every finished and sampled span.
+type SpanExporter interface {
+	ExportSpan(span *Span) error
+}
+
+// Tracer creates spans and hands them to its exporter once they are
+// finished. Register it using `Server.SetTracer` to create a server span for
+// every request.
+type Tracer struct {
+	exporter SpanExporter
+}
+
+// NewTracer creates a new Tracer exporting spans using the given exporter.
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+	}
+}
+
+// StartSpan starts a new span. If parent is valid, the span becomes a child
+// of it and continues its trace, otherwise a new sampled trace is started.
+func (t *Tracer) StartSpan(name string, kind SpanKind, parent SpanContext) *Span {
+	span := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+
+	if parent.IsValid() {
+		span.parentID = parent.SpanID
+		span.context = parent
+	} else {
+		span.context = SpanContext{Flags: traceFlagSampled}
+		randomID(span.context.TraceID[:])
+	}
+	randomID(span.context.SpanID[:])
+
+	return span
+}
+
+// Span represents a single operation within a trace. All methods can be
+// called on a nil span, which is what middlewares get when tracing is
+// disabled.
+type Span struct {
+	tracer   *Tracer
+	name     string
+	kind     SpanKind
+	context  SpanContext
+	parentID SpanID
+	start    time.Time
+	onError  func(err error)
+
+	mutex         sync.Mutex
+	end           time.Time
+	attributes    map[string]string
+	failed        bool
+	statusMessage string
+}
+
+func (s *Span) Name() string {
+	if s == nil {
+		return ""
+	}
+
+	return s.name
+}
+
+func (s *Span) Kind() SpanKind {
+	if s == nil {
+		return 0
+	}
+
+	return s.kind
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.context
+}
+
+// ParentSpanID returns the ID of the parent span, which is invalid for root
+// spans.
+func (s *Span) ParentSpanID() SpanID {
+	if s == nil {
+		return SpanID{}
+	}
+
+	return s.parentID
+}
+
+func (s *Span) Start() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+
+	return s.start
+}
+
+// End returns the time the span was finished, or the zero time.
+func (s *Span) End() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.end
+}
+
+// Attributes returns a copy of the attributes of the span.
+func (s *Span) Attributes() map[string]string {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	attributes := make(map[string]string, len(s.attributes))
+	for k, v := range s.attributes {
+		attributes[k] = v
+	}
+
+	return attributes
+}
+
+// Failed returns true and the error message if SetError was called.
+func (s *Span) Failed() (bool, string) {
+	if s == nil {
+		return false, ""
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.failed, s.statusMessage
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.attributes == nil {
+		s.attributes = map[string]string{}
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the operation of the span as failed.
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failed = true
+	s.statusMessage = message
+}
+
+// StartChild starts a new span as child of this span.
+func (s *Span) StartChild(name string) *Span {
+	if s == nil {
+		return nil
+	}
+
+	child := s.tracer.StartSpan(name, SpanKindInternal, s.context)
+	child.onError = s.onError
+
+	return child
+}
+
+// Finish ends the span and exports it, if sampled. Calling Finish more than
+// once has no effect.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	if !s.end.IsZero() {
+		s.mutex.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mutex.Unlock()
+
+	if !s.context.IsSampled() {
+		return
+	}
+
+	if err := s.tracer.exporter.ExportSpan(s); err != nil && s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// ContextWithSpan returns a copy of ctx carrying the given span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type spanContextKey struct{}
+
+// startServerSpan starts the span for an incoming request, continuing the
+// trace given by the client, if any. Export errors of the span and its
+// children are passed to onError.
+func (t *Tracer) startServerSpan(req *http.Request, onError func(err error)) *Span {
+	parent, err := ParseTraceParent(req.Header.Get(TraceParentHeader))
+	if err == nil {
+		parent.TraceState = req.Header.Get(TraceStateHeader)
+	}
+
+	span := t.StartSpan(currentRouteName(req), SpanKindServer, parent)
+	span.onError = onError
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.target", req.RequestURI)
+
+	return span
+}
+
+func decodeHexID(dst []byte, value string) error {
+	if len(value) != 2*len(dst) || strings.ToLower(value) != value {
+		return errgo.Newf("invalid ID '%s'", value)
+	}
+	if _, err := hex.Decode(dst, []byte(value)); err != nil {
+		return errgo.Mask(err)
+	}
+
+	return nil
+}
+
+func randomID(dst []byte) {
+	if _, err := rand.Read(dst); err != nil {
+		panic(errgo.Mask(err))
+	}
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	DefaultOTLPBatchSize     = 512
+	DefaultOTLPQueueSize     = 2048
+	DefaultOTLPFlushInterval = 5 * time.Second
+
+	otlpScopeName = "github.com/giantswarm/middleware-server"
+)
+
+// NewWriterSpanExporter creates an exporter writing one JSON object per span
+// to w, e.g. os.Stdout or a file. This is meant for testing and debugging.
+func NewWriterSpanExporter(w io.Writer) SpanExporter {
+	return &writerSpanExporter{w: w}
+}
+
+// SpanRecord is the JSON representation of a finished span written by the
+// writer exporter.
+type SpanRecord struct {
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	TraceState   string            `json:"trace_state,omitempty"`
+	Name         string            `json:"name"`
+	Kind         SpanKind          `json:"kind"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	Failed       bool              `json:"failed,omitempty"`
+}
+
+// OTLPOptions configures the OTLPSpanExporter.
+type OTLPOptions struct {
+	// Endpoint is the URL spans are posted to using OTLP/HTTP with JSON
+	// encoding, e.g. "http://localhost:4318/v1/traces".
+	Endpoint string
+
+	// ServiceName is reported as `service.name` resource attribute.
+	ServiceName string
+
+	// Headers are added to every export request, e.g. for authentication.
+	Headers map[string]string
+
+	// BatchSize is the maximum number of spans per export request. Defaults
+	// to DefaultOTLPBatchSize.
+	BatchSize int
+
+	// QueueSize is the maximum number of spans waiting to be exported.
+	// Further spans are dropped. Defaults to DefaultOTLPQueueSize.
+	QueueSize int
+
+	// FlushInterval is the maximum time a span waits to be exported.
+	// Defaults to DefaultOTLPFlushInterval.
+	FlushInterval time.Duration
+
+	// Client is used to post the spans. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// OTLPSpanExporter exports spans in batches to an OpenTelemetry collector,
+// without delaying the requests being traced.
+type OTLPSpanExporter struct {
+	options OTLPOptions
+	queue   chan *Span
+	done    chan struct{}
+	dropped uint64
+	failed  uint64
+
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewOTLPSpanExporter creates an OTLPSpanExporter and starts exporting in the
+// background. Call Close to export the remaining spans when shutting down.
+func NewOTLPSpanExporter(options OTLPOptions) *OTLPSpanExporter {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultOTLPBatchSize
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultOTLPQueueSize
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = DefaultOTLPFlushInterval
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+
+	e := &OTLPSpanExporter{
+		options: options,
+		queue:   make(chan *Span, options.QueueSize),
+		done:    make(chan struct{}),
+	}
+	go e.run()
+
+	return e
+}
+
+// ExportSpan queues the span to be exported. If the queue is full or the
+// exporter is closed, the span is dropped without returning an error, so a
+// slow collector does not cause an error per request. Use Dropped to monitor
+// dropped spans.
+func (e *OTLPSpanExporter) ExportSpan(span *Span) error {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if e.closed {
+		atomic.AddUint64(&e.dropped, 1)
+		return nil
+	}
+
+	select {
+	case e.queue <- span:
+	default:
+		atomic.AddUint64(&e.dropped, 1)
+	}
+
+	return nil
+}
+
+// Dropped returns the number of spans dropped because the queue was full or
+// the exporter was closed.
+func (e *OTLPSpanExporter) Dropped() uint64 {
+	return atomic.LoadUint64(&e.dropped)
+}
+
+// Failed returns the number of spans that could not be posted.
+func (e *OTLPSpanExporter) Failed() uint64 {
+	return atomic.LoadUint64(&e.failed)
+}
+
+// Close exports the queued spans and stops the exporter. Spans exported
+// afterwards are dropped.
+func (e *OTLPSpanExporter) Close() {
+	e.mutex.Lock()
+	if e.closed {
+		e.mutex.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.queue)
+	e.mutex.Unlock()
+
+	<-e.done
+}
+
+//------------------------------------------------------------------------------
+// private
+
+type writerSpanExporter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (e *writerSpanExporter) ExportSpan(span *Span) error {
+	failed, message := span.Failed()
+	record := SpanRecord{
+		TraceID:    span.context.TraceID.String(),
+		SpanID:     span.context.SpanID.String(),
+		TraceState: span.context.TraceState,
+		Name:       span.name,
+		Kind:       span.kind,
+		Start:      span.start,
+		End:        span.End(),
+		Attributes: span.Attributes(),
+		Failed:     failed,
+		Error:      message,
+	}
+	if span.parentID.IsValid() {
+		record.ParentSpanID = span.parentID.String()
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, err := e.w.Write(append(raw, '\n')); err != nil {
+		return errgo.Mask(err)
+	}
+
+	return nil
+}
+
+func (e *OTLPSpanExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, e.options.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.post(batch); err != nil {
+			atomic.AddUint64(&e.failed, uint64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case span, ok := <-e.queue:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, span)
+			if len(batch) >= e.options.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (e *OTLPSpanExporter) post(spans []*Span) error {
+	body, err := json.Marshal(newOTLPRequest(e.options.ServiceName, spans))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	req, err := http.NewRequest("POST", e.options.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.options.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := e.options.Client.Do(req)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return errgo.Newf("OTLP endpoint responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// The following types implement the JSON encoding of the OTLP trace export
+// request, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func newOTLPRequest(serviceName string, spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, newOTLPSpan(span))
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{Key: "service.name", Value: otlpAnyValue{StringValue: serviceName}}},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: otlpScopeName},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func newOTLPSpan(span *Span) otlpSpan {
+	encoded := otlpSpan{
+		TraceID:           span.context.TraceID.String(),
+		SpanID:            span.context.SpanID.String(),
+		TraceState:        span.context.TraceState,
+		Name:              span.name,
+		Kind:              span.kind,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End().UnixNano(), 10),
+	}
+	if span.parentID.IsValid() {
+		encoded.ParentSpanID = span.parentID.String()
+	}
+
+	attributes := span.Attributes()
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		encoded.Attributes = append(encoded.Attributes, otlpAttribute{Key: key, Value: otlpAnyValue{StringValue: attributes[key]}})
+	}
+
+	// OTLP status codes: 0 unset, 1 ok, 2 error.
+	if failed, message := span.Failed(); failed {
+		encoded.Status = otlpStatus{Code: 2, Message: message}
+	}
+
+	return encoded
+}
@@ -0,0 +1,206 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	srvPkg "github.com/giantswarm/middleware-server"
+)
+
+func decodeSpans(out *bytes.Buffer) []srvPkg.SpanRecord {
+	var spans []srvPkg.SpanRecord
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var span srvPkg.SpanRecord
+		Expect(json.Unmarshal([]byte(line), &span)).To(BeNil())
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+var _ = Describe("tracing", func() {
+	Describe("traceparent parsing", func() {
+		It("should parse valid headers", func() {
+			sc, err := srvPkg.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+			Expect(err).To(BeNil())
+			Expect(sc.TraceID.String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			Expect(sc.SpanID.String()).To(Equal("00f067aa0ba902b7"))
+			Expect(sc.IsSampled()).To(BeTrue())
+			Expect(sc.TraceParent()).To(Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+		})
+
+		It("should reject invalid headers", func() {
+			for _, value := range []string{
+				"",
+				"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+				"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+				"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+				"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			} {
+				_, err := srvPkg.ParseTraceParent(value)
+				Expect(err).NotTo(BeNil(), value)
+			}
+		})
+	})
+
+	Describe("server spans", func() {
+		var (
+			srv   *srvPkg.Server
+			out   *bytes.Buffer
+			rec   *httptest.ResponseRecorder
+			spans []srvPkg.SpanRecord
+		)
+
+		BeforeEach(func() {
+			out = &bytes.Buffer{}
+
+			srv = srvPkg.NewServer("", "")
+			srv.SetTracer(srvPkg.NewTracer(srvPkg.NewWriterSpanExporter(out)))
+			srv.Serve("GET", "/hello", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+				span := ctx.StartSpan("database")
+				span.SetAttribute("db.statement", "SELECT 1")
+				span.Finish()
+
+				return ctx.Response.PlainText("hello world", http.StatusOK)
+			})
+		})
+
+		Context("request without traceparent", func() {
+			BeforeEach(func() {
+				rec = serve(srv, httptest.NewRequest("GET", "/hello", nil))
+				spans = decodeSpans(out)
+			})
+
+			It("should export the child and the server span", func() {
+				Expect(spans).To(HaveLen(2))
+				Expect(spans[0].Name).To(Equal("database"))
+				Expect(spans[0].Attributes["db.statement"]).To(Equal("SELECT 1"))
+				Expect(spans[1].Name).To(Equal("GET /hello"))
+				Expect(spans[1].Kind).To(Equal(srvPkg.SpanKindServer))
+				Expect(spans[1].Attributes["http.status_code"]).To(Equal("200"))
+			})
+
+			It("should start a new trace", func() {
+				Expect(spans[1].ParentSpanID).To(BeEmpty())
+				Expect(spans[0].TraceID).To(Equal(spans[1].TraceID))
+				Expect(spans[0].ParentSpanID).To(Equal(spans[1].SpanID))
+			})
+
+			It("should send the traceparent of the server span", func() {
+				Expect(rec.Header().Get("traceparent")).To(Equal("00-" + spans[1].TraceID + "-" + spans[1].SpanID + "-01"))
+			})
+		})
+
+		Context("request with traceparent", func() {
+			BeforeEach(func() {
+				req := httptest.NewRequest("GET", "/hello", nil)
+				req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+				req.Header.Set("tracestate", "vendor=value")
+				rec = serve(srv, req)
+				spans = decodeSpans(out)
+			})
+
+			It("should continue the trace", func() {
+				Expect(spans[1].TraceID).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+				Expect(spans[1].ParentSpanID).To(Equal("00f067aa0ba902b7"))
+				Expect(spans[1].TraceState).To(Equal("vendor=value"))
+				Expect(rec.Header().Get("tracestate")).To(Equal("vendor=value"))
+			})
+		})
+
+		Context("request with unsampled traceparent", func() {
+			It("should not export spans", func() {
+				req := httptest.NewRequest("GET", "/hello", nil)
+				req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+				rec = serve(srv, req)
+
+				Expect(out.Len()).To(Equal(0))
+				Expect(rec.Header().Get("traceparent")).To(HaveSuffix("-00"))
+			})
+		})
+
+		It("should disable tracing when setting nil", func() {
+			srv.SetTracer(nil)
+			rec = serve(srv, httptest.NewRequest("GET", "/hello", nil))
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Header().Get("traceparent")).To(BeEmpty())
+			Expect(out.Len()).To(Equal(0))
+		})
+
+		It("should log export errors using the logger of the server serving the request", func() {
+			r, w := io.Pipe()
+			r.Close()
+			tracer := srvPkg.NewTracer(srvPkg.NewWriterSpanExporter(w))
+
+			loggers := []*srvPkg.RecordingLogger{srvPkg.NewRecordingLogger(), srvPkg.NewRecordingLogger()}
+			for _, logger := range loggers {
+				s := srvPkg.NewServer("", "")
+				s.SetLogger(logger)
+				s.SetAccessReporter(nil)
+				s.SetTracer(tracer)
+				s.Serve("GET", "/hello", func(res http.ResponseWriter, req *http.Request, ctx *srvPkg.Context) error {
+					ctx.StartSpan("database").Finish()
+					return ctx.Response.PlainText("hello world", http.StatusOK)
+				})
+
+				serve(s, httptest.NewRequest("GET", "/hello", nil))
+			}
+
+			for _, logger := range loggers {
+				records := logger.Records()
+				Expect(records).To(HaveLen(2))
+				for _, record := range records {
+					Expect(record.Level).To(Equal("ERROR"))
+					Expect(record.Message).To(Equal("exporting span failed"))
+				}
+			}
+		})
+	})
+
+	Describe("OTLP exporter", func() {
+		It("should post the spans to the collector", func() {
+			bodies := make(chan []byte, 1)
+			collector := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				body, _ := ioutil.ReadAll(req.Body)
+				bodies <- body
+			}))
+			defer collector.Close()
+
+			exporter := srvPkg.NewOTLPSpanExporter(srvPkg.OTLPOptions{
+				Endpoint:      collector.URL,
+				ServiceName:   "test-service",
+				FlushInterval: time.Hour,
+			})
+			tracer := srvPkg.NewTracer(exporter)
+			tracer.StartSpan("test-span", srvPkg.SpanKindInternal, srvPkg.SpanContext{}).Finish()
+			exporter.Close()
+
+			var body []byte
+			Eventually(bodies).Should(Receive(&body))
+			Expect(string(body)).To(ContainSubstring(`"stringValue":"test-service"`))
+			Expect(string(body)).To(ContainSubstring(`"name":"test-span"`))
+			Expect(exporter.Failed()).To(BeZero())
+		})
+
+		It("should count dropped spans without failing", func() {
+			exporter := srvPkg.NewOTLPSpanExporter(srvPkg.OTLPOptions{Endpoint: "http://127.0.0.1:0"})
+			exporter.Close()
+
+			span := srvPkg.NewTracer(exporter).StartSpan("test-span", srvPkg.SpanKindInternal, srvPkg.SpanContext{})
+			span.Finish()
+			Expect(exporter.ExportSpan(span)).To(BeNil())
+			Expect(exporter.Dropped()).To(Equal(uint64(2)))
+		})
+	})
+})
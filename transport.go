@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper adding the request ID and the trace
+// context of the incoming request to outgoing requests, so they can be
+// followed across services. Headers already set on the outgoing request are
+// kept.
+type Transport struct {
+	// Base performs the requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Header is the header the request ID is sent in. Defaults to
+	// RequestIDHeader.
+	Header string
+
+	ctx context.Context
+}
+
+// NewTransport creates a Transport propagating the request ID and span
+// carried by ctx, see RequestIDFromContext and SpanFromContext. If ctx is
+// nil, the context of every outgoing request is used instead, so a single
+// client can be shared, e.g.
+// `client.Do(outReq.WithContext(req.Context()))`.
+func NewTransport(ctx context.Context, base http.RoundTripper) *Transport {
+	return &Transport{
+		Base: base,
+		ctx:  ctx,
+	}
+}
+
+// Transport creates a Transport propagating the ID and span of the current
+// request, e.g. `client := &http.Client{Transport: ctx.Transport(nil)}`. The
+// ID is sent in the header configured by `RequestIDOptions.ResponseHeader`.
+func (c *Context) Transport(base http.RoundTripper) *Transport {
+	ctx := ContextWithRequestID(context.Background(), c.RequestID())
+	if c.span != nil {
+		ctx = ContextWithSpan(ctx, c.span)
+	}
+
+	t := NewTransport(ctx, base)
+	t.Header = c.requestIDHeader
+
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = req.Context()
+	}
+
+	// A RoundTripper must not modify the request.
+	req = req.Clone(req.Context())
+
+	header := t.Header
+	if header == "" {
+		header = RequestIDHeader
+	}
+	if id := RequestIDFromContext(ctx); id != "" && req.Header.Get(header) == "" {
+		req.Header.Set(header, id)
+	}
+
+	if span := SpanFromContext(ctx); span != nil && req.Header.Get(TraceParentHeader) == "" {
+		sc := span.SpanContext()
+		req.Header.Set(TraceParentHeader, sc.TraceParent())
+		if sc.TraceState != "" {
+			req.Header.Set(TraceStateHeader, sc.TraceState)
+		}
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return base.RoundTrip(req)
+}